@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"sort"
+	"strings"
+)
+
+// command offline subcommand run with its own arguments
+type command func(args []string) error
+
+// commands subcommands by name, the server is started when none is given
+var commands = map[string]command{
+	"compact":   compactCommand,
+	"export":    exportCommand,
+	"import":    importCommand,
+	"migrate":   migrateCommand,
+	"reencrypt": reencryptCommand,
+	"verify":    verifyCommand,
+}
+
+// runCommand runs the subcommand named by the first argument, returns false if there is none
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return false, nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return true, fmt.Errorf("unknown command %q, available: %s", args[0], strings.Join(names, ", "))
+	}
+	return true, cmd(args[1:])
+}
+
+// storageFlags registers the -f storage path and -s storage DSN flags with the
+// FILE_STORAGE_PATH and STORAGE_DSN defaults, the returned function gives the DSN
+func storageFlags(fs *flag.FlagSet) func() string {
+	env := config.GetEnvConfig()
+	path := storagePathFlag(fs, env)
+	dsn := fs.String("s", env.StorageDSN, "storage DSN (scheme:location), file:<-f path> by default")
+	return func() string {
+		if *dsn != "" {
+			return *dsn
+		}
+		return "file:" + *path
+	}
+}
+
+// storagePathFlag registers the -f storage path flag with the FILE_STORAGE_PATH default
+func storagePathFlag(fs *flag.FlagSet, env config.EnvConfig) *string {
+	path := env.FileStoragePath
+	if path == "" {
+		path = "/tmp/storage.txt"
+	}
+	return fs.String("f", path, "path to file storage")
+}
+
+// openStorage opens the storage of a subcommand like the server does: encrypted
+// with the ENCRYPTION_KEYS keys if they are set
+func openStorage(dsn string, readOnly bool) (storage.Storage, error) {
+	open := storage.Open
+	if readOnly {
+		open = storage.OpenReadOnly
+	}
+	store, err := open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := encryptStorage(store, config.GetEnvConfig().EncryptionKeys)
+	if err != nil {
+		closeStorage(store)
+		return nil, err
+	}
+	return encrypted, nil
+}
+
+// encryptStorage wraps the storage in an EncryptedStorage if encryption keys are given
+func encryptStorage(store storage.Storage, keys string) (storage.Storage, error) {
+	if keys == "" {
+		return store, nil
+	}
+	keyring, err := storage.ParseKeyring(keys)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("Encrypting target URLs with key %s", keyring.Active())
+	return storage.NewEncryptedStorage(store, keyring), nil
+}
+
+// newFlagSet creates the flag set of a subcommand
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: shortener %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// closeStorage closes the storage if it holds resources
+func closeStorage(s storage.Storage) {
+	if closer, ok := s.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
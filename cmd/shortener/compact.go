@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"time"
+)
+
+// compactCommand rewrites the storage to only live records
+func compactCommand(args []string) error {
+	fs := newFlagSet("compact", "[flags]")
+	dsn := storageFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	store, err := openStorage(dsn(), false)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(store)
+	compactor, ok := storage.Unwrap(store).(storage.Compactor)
+	if !ok {
+		return fmt.Errorf("storage does not support compaction: %s", dsn())
+	}
+	_, err = compactor.Compact(time.Now())
+	return err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/app"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"os"
+)
+
+// exportCommand writes all records of the storage as JSONL
+func exportCommand(args []string) error {
+	fs := newFlagSet("export", "[flags]")
+	dsn := storageFlags(fs)
+	output := fs.String("o", "", "output file, stdout by default")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	store, err := openStorage(dsn(), true)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(store)
+	if *output == "" {
+		return exportRows(store, os.Stdout)
+	}
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := exportRows(store, file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// exportRows writes the records and logs their count
+func exportRows(store storage.Storage, w io.Writer) error {
+	count, err := app.ExportRows(store, w)
+	if err != nil {
+		return err
+	}
+	log.Infof("Export finished: rows=%d", count)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/app"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"os"
+)
+
+// importCommand imports CSV or NDJSON files into the storage
+func importCommand(args []string) error {
+	fs := newFlagSet("import", "[flags] file...")
+	dsn := storageFlags(fs)
+	format := fs.String("format", "", "input format: text/csv or application/x-ndjson, detected from the file extension by default")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no files to import")
+	}
+
+	store, err := openStorage(dsn(), false)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(store)
+	failed := 0
+	for _, filename := range fs.Args() {
+		report, importErr := importFile(store, filename, *format)
+		if importErr != nil {
+			report.Error = importErr.Error()
+		}
+		// the report goes to stdout so it can be processed by scripts, also the
+		// partial report of an aborted import
+		reportBytes, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", filename, reportBytes)
+		if importErr != nil {
+			return fmt.Errorf("%s: %v", filename, importErr)
+		}
+		failed += report.Failed
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d rows failed to import", failed)
+	}
+	return nil
+}
+
+// importFile imports a single file
+func importFile(store storage.Storage, filename, format string) (app.ImportReport, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return app.ImportReport{}, err
+	}
+	defer file.Close()
+	format, err = app.ImportFormat(format, filename)
+	if err != nil {
+		return app.ImportReport{}, err
+	}
+	return app.ImportRows(store, file, format)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
 	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
 	"net/http"
+	"os"
 )
 
 // Main function
@@ -14,14 +15,64 @@ func main() {
 	log.InitializeLogger()
 	defer log.Logger.Sync()
 
+	// run offline subcommand if given
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// parse config
 	config.ParseConfig()
+	if err := app.ValidateRedirectCode(config.Config.RedirectCode); err != nil {
+		panic(err)
+	}
+	if err := app.ValidateSchemes(config.Config.AllowedSchemes); err != nil {
+		panic(err)
+	}
+	if config.Config.PrimaryURL != "" {
+		if err := app.ValidateURL(config.Config.PrimaryURL); err != nil {
+			panic(err)
+		}
+	}
+
+	// load UTM templates
+	if config.Config.UTMTemplates != "" {
+		if err := app.LoadUTMTemplates(config.Config.UTMTemplates); err != nil {
+			panic(err)
+		}
+	}
+
+	// load target URL policy
+	if config.Config.PolicyFile != "" {
+		if _, err := app.LoadPolicy(config.Config.PolicyFile); err != nil {
+			panic(err)
+		}
+	}
 
 	// init storage
-	store, err := storage.NewFileStorage(config.Config.FileStoragePath)
+	store, err := storage.Open(config.Config.StorageDSN)
+	if err != nil {
+		panic(err)
+	}
+	store, err = encryptStorage(store, config.Config.EncryptionKeys)
 	if err != nil {
 		panic(err)
 	}
+	// a read-only storage indexes the file in memory already, a follower also
+	// learns new records from the primary
+	readOnly := storage.IsReadOnly(store)
+	if config.Config.BloomFPRate > 0 && !readOnly {
+		store, err = storage.NewBloomStorage(store, config.Config.BloomFPRate)
+		if err != nil {
+			panic(err)
+		}
+	}
+	if config.Config.CacheSize > 0 && !readOnly {
+		log.Infof("Caching up to %d records", config.Config.CacheSize)
+		store = storage.NewCachedStorage(store, config.Config.CacheSize, config.Config.CacheNegativeTTL)
+	}
 	app.SetStore(store)
 
 	// start server
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+)
+
+// migrateCommand copies all records between storage backends
+func migrateCommand(args []string) error {
+	fs := newFlagSet("migrate", "--from scheme:location --to scheme:location")
+	from := fs.String("from", "", "source storage DSN")
+	to := fs.String("to", "", "target storage DSN")
+	fs.Parse(args)
+	if *from == "" || *to == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("both --from and --to storage DSNs are required")
+	}
+	if *from == *to {
+		return fmt.Errorf("source and target storage are the same: %s", *from)
+	}
+
+	// with encryption keys the records are decrypted from the source and
+	// encrypted with the active key for the target
+	source, err := openStorage(*from, true)
+	if err != nil {
+		return fmt.Errorf("source: %v", err)
+	}
+	defer closeStorage(source)
+	target, err := openStorage(*to, false)
+	if err != nil {
+		return fmt.Errorf("target: %v", err)
+	}
+	defer closeStorage(target)
+	report, err := storage.Migrate(source, target)
+	log.Infof("Migration report: copied=%d; skipped=%d; source=%d; target=%d",
+		report.Copied, report.Skipped, report.SourceCount, report.TargetCount)
+	return err
+}
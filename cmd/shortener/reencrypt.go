@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+)
+
+// reencryptCommand encrypts all records with the active key after a key rotation
+func reencryptCommand(args []string) error {
+	fs := newFlagSet("reencrypt", "[flags]")
+	dsn := storageFlags(fs)
+	keys := fs.String("keys", config.GetEnvConfig().EncryptionKeys,
+		"encryption keys id:base64key[,id:base64key...], the first one is active; prefer ENCRYPTION_KEYS")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if *keys == "" {
+		return fmt.Errorf("encryption keys are required")
+	}
+	keyring, err := storage.ParseKeyring(*keys)
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.Open(dsn())
+	if err != nil {
+		return err
+	}
+	defer closeStorage(store)
+	report, err := storage.Reencrypt(store, keyring)
+	log.Infof("Re-encryption report: records=%d; reencrypted=%d; key=%s",
+		report.Records, report.Reencrypted, keyring.Active())
+	if err == nil && report.Reencrypted > 0 {
+		if _, ok := store.(storage.Compactor); ok {
+			log.Infof("Run shortener compact to drop the records encrypted with the old keys")
+		}
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"os"
+)
+
+// verifyCommand checks the storage file and optionally writes a repaired copy
+func verifyCommand(args []string) error {
+	fs := newFlagSet("verify", "[flags]")
+	path := storagePathFlag(fs, config.GetEnvConfig())
+	output := fs.String("o", "", "write a repaired copy to this file")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if *output == *path {
+		return fmt.Errorf("the repaired copy must not overwrite the storage file: %s", *path)
+	}
+
+	var repaired io.Writer
+	var file *os.File
+	if *output != "" {
+		var err error
+		if file, err = os.Create(*output); err != nil {
+			return err
+		}
+		repaired = file
+	}
+	report, err := storage.VerifyFile(*path, repaired)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	// the report goes to stdout so it can be processed by scripts
+	reportBytes, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(reportBytes))
+	if len(report.Issues) > 0 {
+		return fmt.Errorf("%d issues found in %s", len(report.Issues), *path)
+	}
+	return nil
+}
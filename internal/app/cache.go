@@ -0,0 +1,26 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"net/http"
+)
+
+// CacheStatsHandler Handle lookup cache statistics requests
+func CacheStatsHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("GET /api/cache")
+	cache, ok := store.(*storage.CachedStorage)
+	if !ok {
+		http.Error(res, "Cache is disabled", http.StatusNotFound)
+		return
+	}
+	responseBytes, err := json.Marshal(cache.Stats())
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseBytes)
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCacheStatsHandler tests the lookup cache statistics endpoint
+func TestCacheStatsHandler(t *testing.T) {
+	setupListStore(t)
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	getStats := func() *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/cache", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := getStats()
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	SetStore(storage.NewCachedStorage(store, 10, time.Minute))
+	store.AddURL("cache1", "https://example.com/1")
+	store.GetURL("cache1")
+	store.GetURL("cache1")
+
+	resp = getStats()
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var stats storage.CacheStats
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&stats))
+	assert.Equal(t, storage.CacheStats{Hits: 1, Misses: 1, Entries: 1, Size: 10}, stats)
+}
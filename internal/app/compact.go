@@ -0,0 +1,32 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"net/http"
+	"time"
+)
+
+// CompactHandler Handle online compaction requests of the storage
+func CompactHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("POST /api/compact")
+	compactor, ok := storage.Unwrap(store).(storage.Compactor)
+	if !ok {
+		http.Error(res, "Storage does not support compaction", http.StatusNotImplemented)
+		return
+	}
+	report, err := compactor.Compact(time.Now())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	responseBytes, err := json.Marshal(report)
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseBytes)
+}
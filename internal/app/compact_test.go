@@ -0,0 +1,39 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestCompactHandler tests the online compaction endpoint
+func TestCompactHandler(t *testing.T) {
+	setupListStore(t)
+	store.AddURL("cmp1", "https://example.com/1")
+	row, _, _ := store.GetRow("cmp1")
+	row.OriginalURL = "https://example.com/2"
+	store.UpdateRow(row)
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/compact", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var report storage.CompactReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, storage.CompactReport{Lines: 2, Records: 1}, report)
+}
@@ -0,0 +1,155 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"net/http"
+	"time"
+)
+
+// PATCH structure of the request body, absent fields are left unchanged
+type editRequest struct {
+	URL          *string      `json:"url"`
+	RedirectCode *int         `json:"redirect_code"`
+	ExpiresAt    optionalTime `json:"expires_at"`
+	Title        *string      `json:"title"`
+	Tags         *[]string    `json:"tags"`
+	Notes        *string      `json:"notes"`
+}
+
+// optionalTime time field telling an absent value from an explicit null
+type optionalTime struct {
+	// Set the field is present, a nil Value means null
+	Set   bool
+	Value *time.Time
+}
+
+// UnmarshalJSON decodes a time or null
+func (o *optionalTime) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	if string(data) == "null" {
+		o.Value = nil
+		return nil
+	}
+	var value time.Time
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
+
+// Validate checks if the present fields are valid
+func (r *editRequest) Validate() error {
+	if r.URL != nil {
+		if err := ValidateURL(*r.URL); err != nil {
+			return err
+		}
+		url, err := canonicalURL(*r.URL)
+		if err != nil {
+			return err
+		}
+		r.URL = &url
+	}
+	if r.RedirectCode != nil && *r.RedirectCode != 0 {
+		return ValidateRedirectCode(*r.RedirectCode)
+	}
+	return nil
+}
+
+// Apply records the current values in the history and applies the changes
+func (r *editRequest) Apply(row *storage.DataRow, now time.Time) {
+	row.History = append(row.History, storage.DataRowEdit{
+		EditedAt:     now,
+		OriginalURL:  row.OriginalURL,
+		RedirectCode: row.RedirectCode,
+		ExpiresAt:    row.ExpiresAt,
+		Title:        row.Title,
+		Tags:         row.Tags,
+		Notes:        row.Notes,
+	})
+	if r.URL != nil {
+		row.OriginalURL = *r.URL
+	}
+	if r.RedirectCode != nil {
+		row.RedirectCode = *r.RedirectCode
+	}
+	// an explicit null removes the expiration
+	if r.ExpiresAt.Set {
+		row.ExpiresAt = r.ExpiresAt.Value
+	}
+	if r.Title != nil {
+		row.Title = *r.Title
+	}
+	if r.Tags != nil {
+		row.Tags = *r.Tags
+	}
+	if r.Notes != nil {
+		row.Notes = *r.Notes
+	}
+}
+
+// PatchURLHandler Handle PATCH requests editing a short link, the short ID is kept
+func PatchURLHandler(res http.ResponseWriter, req *http.Request) {
+	id := chi.URLParam(req, "id")
+	log.Infof("PATCH /api/urls/%s", id)
+	if req.Body == nil {
+		http.Error(res, "Empty body", http.StatusBadRequest)
+		return
+	}
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, "Unable to read body", http.StatusBadRequest)
+		return
+	}
+	if len(bodyBytes) == 0 {
+		http.Error(res, "Empty body", http.StatusBadRequest)
+		return
+	}
+	var request editRequest
+	if err := json.Unmarshal(bodyBytes, &request); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := request.Validate(); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.URL != nil {
+		url, err := resolveSelfURL(*request.URL, id)
+		if err != nil {
+			http.Error(res, err.Error(), selfLinkStatus(err))
+			return
+		}
+		request.URL = &url
+		if err := checkPolicy(url); err != nil {
+			http.Error(res, err.Error(), policyStatus(err))
+			return
+		}
+	}
+	row, ok, err := storage.EditRow(store, id, func(row *storage.DataRow) error {
+		request.Apply(row, time.Now().UTC())
+		return nil
+	})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		log.Infof("Url not found: %s", id)
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	log.Infof("Url edited: url=%s; hash=%s", row.OriginalURL, id)
+	responseBytes, err := json.Marshal(row)
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseBytes)
+}
@@ -0,0 +1,237 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPatchURLHandler tests the PatchURLHandler function
+func TestPatchURLHandler(t *testing.T) {
+	setup()
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	store.AddRow(storage.DataRow{ShortURL: "editable", OriginalURL: "https://example.com/old"})
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		body string
+		code int
+	}{
+		{
+			name: "Change target and redirect code",
+			url:  "/api/urls/editable",
+			body: `{"url": "https://example.com/new", "redirect_code": 308}`,
+			code: http.StatusOK,
+		},
+		{
+			name: "Wrong URL",
+			url:  "/api/urls/editable",
+			body: `{"url": "111"}`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "Wrong redirect code",
+			url:  "/api/urls/editable",
+			body: `{"redirect_code": 200}`,
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "Empty body",
+			url:  "/api/urls/editable",
+			body: "",
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "Non-existing hash",
+			url:  "/api/urls/nonexistent",
+			body: `{"url": "https://example.com/new"}`,
+			code: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, _ := testAdminRequest(t, ts, http.MethodPatch, tt.url, tt.body)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+		})
+	}
+
+	row, ok, err := store.GetRow("editable")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "https://example.com/new", row.OriginalURL)
+	assert.Equal(t, http.StatusPermanentRedirect, row.RedirectCode)
+	require.Len(t, row.History, 1)
+	assert.Equal(t, "https://example.com/old", row.History[0].OriginalURL)
+
+	resp, _ := testRequest(t, ts, http.MethodGet, "/editable", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusPermanentRedirect, resp.StatusCode)
+	assert.Equal(t, "https://example.com/new", resp.Header.Get("Location"))
+}
+
+// TestPatchURLHandlerExpiry tests that expired links are no longer redirected
+func TestPatchURLHandlerExpiry(t *testing.T) {
+	setup()
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	store.AddRow(storage.DataRow{ShortURL: "expiring", OriginalURL: "https://example.com/expiring"})
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	expiresAt, err := json.Marshal(time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	resp, _ := testAdminRequest(t, ts, http.MethodPatch, "/api/urls/expiring", `{"expires_at": `+string(expiresAt)+`}`)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, _ = testRequest(t, ts, http.MethodGet, "/expiring", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	// an explicit null removes the expiration, an absent field keeps it
+	resp, _ = testAdminRequest(t, ts, http.MethodPatch, "/api/urls/expiring", `{"title": "Expiring"}`)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	row, _, err := store.GetRow("expiring")
+	require.NoError(t, err)
+	assert.NotNil(t, row.ExpiresAt)
+
+	resp, _ = testAdminRequest(t, ts, http.MethodPatch, "/api/urls/expiring", `{"expires_at": null}`)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp, _ = testRequest(t, ts, http.MethodGet, "/expiring", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+}
+
+// TestPatchURLHandlerHistory tests that edits of the metadata are recorded in the history
+func TestPatchURLHandlerHistory(t *testing.T) {
+	setupListStore(t)
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	store.AddRow(storage.DataRow{ShortURL: "meta", OriginalURL: "https://example.com/meta", Title: "Old", Tags: []string{"a"}, Notes: "old notes"})
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	resp, _ := testAdminRequest(t, ts, http.MethodPatch, "/api/urls/meta", `{"title": "New", "tags": ["b"], "notes": "new notes"}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	row, _, err := store.GetRow("meta")
+	require.NoError(t, err)
+	assert.Equal(t, "New", row.Title)
+	require.Len(t, row.History, 1)
+	assert.Equal(t, "Old", row.History[0].Title)
+	assert.Equal(t, []string{"a"}, row.History[0].Tags)
+	assert.Equal(t, "old notes", row.History[0].Notes)
+}
+
+// TestPatchURLHandlerAuth tests that only admins can edit links
+func TestPatchURLHandlerAuth(t *testing.T) {
+	setupListStore(t)
+	store.AddRow(storage.DataRow{ShortURL: "guarded", OriginalURL: "https://example.com/guarded"})
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	body := `{"url": "https://attacker.example.com/"}`
+
+	// the admin API is disabled without a token
+	resp, _ := testRequest(t, ts, http.MethodPatch, "/api/urls/guarded", body)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	resp, _ = testRequest(t, ts, http.MethodPatch, "/api/urls/guarded", body)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	url, _, err := store.GetURL("guarded")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/guarded", url)
+}
+
+// testAdminRequest makes a request with the admin token
+func testAdminRequest(t *testing.T, ts *httptest.Server, method, path string, body string) (*http.Response, string) {
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+config.Config.AdminToken)
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(respBody)
+}
+
+// TestPatchURLHandlerRetarget tests that shortening a retargeted URL again gives a new link
+func TestPatchURLHandlerRetarget(t *testing.T) {
+	setupListStore(t)
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	original := "https://example.com/retarget"
+	resp, body := testRequest(t, ts, http.MethodPost, "/", original)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	hash := getHash(original)
+	assert.Equal(t, config.Config.BaseURL+"/"+hash, body)
+
+	resp, _ = testAdminRequest(t, ts, http.MethodPatch, "/api/urls/"+hash, `{"url": "https://example.com/moved"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, body = testRequest(t, ts, http.MethodPost, "/", original)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NotEqual(t, config.Config.BaseURL+"/"+hash, body)
+	resp, jsonBody := testRequest(t, ts, http.MethodPost, "/api/shorten", `{"url": "`+original+`"}`)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.JSONEq(t, `{"result": "`+body+`"}`, jsonBody)
+
+	resp, _ = testRequest(t, ts, http.MethodGet, strings.TrimPrefix(body, config.Config.BaseURL), "")
+	assert.Equal(t, original, resp.Header.Get("Location"))
+}
+
+// TestPatchURLHandlerConcurrent tests that concurrent edits keep every history entry
+func TestPatchURLHandlerConcurrent(t *testing.T) {
+	setupListStore(t)
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	store.AddRow(storage.DataRow{ShortURL: "busy", OriginalURL: "https://example.com/busy"})
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, _ := testAdminRequest(t, ts, http.MethodPatch, "/api/urls/busy", fmt.Sprintf(`{"title": "edit %d"}`, i))
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}(i)
+	}
+	wg.Wait()
+
+	row, _, err := store.GetRow("busy")
+	require.NoError(t, err)
+	assert.Len(t, row.History, 20)
+}
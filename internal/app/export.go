@@ -0,0 +1,45 @@
+package app
+
+import (
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"net/http"
+)
+
+// ExportRows writes all records of the storage as JSONL DataRow lines,
+// the same format FileStorage uses, and returns the number of records written
+func ExportRows(s storage.Storage, w io.Writer) (int, error) {
+	writer := newRowWriter(contentTypeNDJSON, w)
+	count := 0
+	var writeErr error
+	err := s.Range(0, false, func(row storage.DataRow) bool {
+		if writeErr = writer.WriteRow(row); writeErr != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, writeErr
+}
+
+// ExportHandler Handle full data export requests
+func ExportHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("GET /api/export")
+	res.Header().Set("Content-Type", contentTypeNDJSON)
+	res.Header().Set("Content-Disposition", `attachment; filename="export.jsonl"`)
+	count, err := ExportRows(store, res)
+	if err != nil && count == 0 {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		// the status is already sent, the client sees a truncated export
+		log.Error(err)
+		return
+	}
+	log.Infof("Export finished: rows=%d", count)
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestExportRows tests that the export can be restored by the file storage
+func TestExportRows(t *testing.T) {
+	setupListStore(t)
+	store.AddRow(storage.DataRow{ShortURL: "exp1", OriginalURL: "https://example.com/1", Tags: []string{"a"}})
+	store.AddRow(storage.DataRow{ShortURL: "exp2", OriginalURL: "https://example.com/2"})
+
+	file, err := os.CreateTemp("", "export_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+	count, err := ExportRows(store, file)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	file.Close()
+
+	restored, err := storage.NewFileStorage(file.Name())
+	require.NoError(t, err)
+	row, ok, err := restored.GetRow("exp1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, []string{"a"}, row.Tags)
+}
+
+// TestExportRowsEncrypted tests that the export of an encrypted storage with checksums verifies
+func TestExportRowsEncrypted(t *testing.T) {
+	setup()
+	source, err := os.CreateTemp("", "export_test.json")
+	require.NoError(t, err)
+	defer os.Remove(source.Name())
+	defer os.Remove(source.Name() + ".lock")
+	backend, err := storage.NewFileStorage(source.Name(), storage.WithChecksums())
+	require.NoError(t, err)
+	defer backend.Close()
+	keys, err := storage.ParseKeyring("k1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{'k'}, 32)))
+	require.NoError(t, err)
+	encrypted := storage.NewEncryptedStorage(backend, keys)
+	require.NoError(t, encrypted.AddURL("enc1", "https://example.com/1"))
+	require.NoError(t, encrypted.AddURL("enc2", "https://example.com/2"))
+
+	var exported bytes.Buffer
+	count, err := ExportRows(encrypted, &exported)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.NotContains(t, exported.String(), `"crc"`)
+
+	file, err := os.CreateTemp("", "export_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.Write(exported.Bytes())
+	file.Close()
+	report, err := storage.VerifyFile(file.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Records)
+	assert.Empty(t, report.Issues)
+}
+
+// TestExportHandler tests the admin authorization of the export endpoint
+func TestExportHandler(t *testing.T) {
+	setupListStore(t)
+	store.AddRow(storage.DataRow{ShortURL: "exp1", OriginalURL: "https://example.com/1"})
+	defer func() { config.Config.AdminToken = "" }()
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		adminToken    string
+		authorization string
+		code          int
+	}{
+		{
+			name:          "Admin API disabled",
+			authorization: "Bearer secret",
+			code:          http.StatusForbidden,
+		},
+		{
+			name:       "Missing token",
+			adminToken: "secret",
+			code:       http.StatusUnauthorized,
+		},
+		{
+			name:          "Wrong token",
+			adminToken:    "secret",
+			authorization: "Bearer wrong",
+			code:          http.StatusUnauthorized,
+		},
+		{
+			name:          "Valid token",
+			adminToken:    "secret",
+			authorization: "Bearer secret",
+			code:          http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.AdminToken = tt.adminToken
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/api/export", nil)
+			require.NoError(t, err)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, contentTypeNDJSON, resp.Header.Get("Content-Type"))
+				var body bytes.Buffer
+				body.ReadFrom(resp.Body)
+				assert.Contains(t, body.String(), `"short_url":"exp1"`)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFollowerDSN tests that a follower configured only through the storage DSN rejects writes
+func TestFollowerDSN(t *testing.T) {
+	setup()
+	closeStore()
+	file, err := os.CreateTemp("", "follower_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+	primary, err := storage.NewFileStorage(file.Name())
+	require.NoError(t, err)
+	defer primary.Close()
+	require.NoError(t, primary.AddURL("followed", "https://example.com/followed"))
+
+	config.Config.FollowInterval = 0
+	config.Config.PrimaryURL = ""
+	follower, err := storage.Open("file:" + file.Name() + "?follow=1s")
+	require.NoError(t, err)
+	SetStore(storage.NewCachedStorage(follower, 10, 0))
+	defer closeStore()
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	result, _ := testRequest(t, ts, http.MethodPost, "/api/shorten", `{"url": "https://example.com/write"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, result.StatusCode)
+
+	result, _ = testRequest(t, ts, http.MethodGet, "/followed", "")
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+}
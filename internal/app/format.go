@@ -0,0 +1,258 @@
+package app
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Content types supported by the list endpoint
+const (
+	contentTypeText   = "text/plain"
+	contentTypeJSON   = "application/json"
+	contentTypeCSV    = "text/csv"
+	contentTypeNDJSON = "application/x-ndjson"
+)
+
+// csvColumns CSV header reusing the DataRow JSON field names
+var csvColumns = []string{
+	"uuid", "short_url", "original_url", "created_at", "redirect_code",
+	"passthrough", "expires_at", "title", "tags", "notes",
+}
+
+// rowWriter writes records one by one in a specific format
+type rowWriter interface {
+	// WriteRow writes a single record
+	WriteRow(row storage.DataRow) error
+	// Close writes the trailing part of the output
+	Close() error
+}
+
+// negotiateContentType returns the supported content type with the highest q-value
+// in the Accept header, the first one on a tie. An empty Accept header or a
+// wildcard selects plain text, an explicit plain text entry takes precedence over
+// the wildcards; q=0 and unsupported types give "".
+func negotiateContentType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeText
+	}
+	best, bestQ := "", 0.0
+	explicitText := false
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		contentType := mediaType
+		switch mediaType {
+		case "text/*", "*/*":
+			if explicitText {
+				continue
+			}
+			contentType = contentTypeText
+		case contentTypeText:
+			explicitText = true
+			if best == contentTypeText {
+				// the explicit entry overrides an earlier wildcard
+				best, bestQ = "", 0
+			}
+		case contentTypeJSON, contentTypeCSV, contentTypeNDJSON:
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+	return best
+}
+
+// flushRows number of rows after which a streamed response is flushed
+const flushRows = 100
+
+// newRowWriter creates a writer for the content type, the output is flushed
+// every flushRows rows if w is an http.Flusher
+func newRowWriter(contentType string, w io.Writer) rowWriter {
+	var writer rowWriter
+	switch contentType {
+	case contentTypeJSON:
+		writer = &jsonRowWriter{w: w}
+	case contentTypeCSV:
+		writer = &csvRowWriter{w: csv.NewWriter(w)}
+	case contentTypeNDJSON:
+		writer = &ndjsonRowWriter{encoder: json.NewEncoder(w)}
+	default:
+		writer = &textRowWriter{w: w}
+	}
+	if flusher, ok := w.(http.Flusher); ok {
+		return &flushingRowWriter{rowWriter: writer, flusher: flusher}
+	}
+	return writer
+}
+
+// flushingRowWriter flushes the response every flushRows rows, so the rows
+// are sent while the storage is still being read
+type flushingRowWriter struct {
+	rowWriter
+	flusher http.Flusher
+	count   int
+}
+
+func (f *flushingRowWriter) WriteRow(row storage.DataRow) error {
+	if err := f.rowWriter.WriteRow(row); err != nil {
+		return err
+	}
+	f.count++
+	if f.count%flushRows == 0 {
+		f.flusher.Flush()
+	}
+	return nil
+}
+
+func (f *flushingRowWriter) Close() error {
+	if err := f.rowWriter.Close(); err != nil {
+		return err
+	}
+	f.flusher.Flush()
+	return nil
+}
+
+// textRowWriter writes records as "hash -> url" lines
+type textRowWriter struct {
+	w io.Writer
+}
+
+func (t *textRowWriter) WriteRow(row storage.DataRow) error {
+	_, err := io.WriteString(t.w, formatRow(row)+"\n")
+	return err
+}
+
+func (t *textRowWriter) Close() error {
+	return nil
+}
+
+// formatRow formats a record as a plain text line with its metadata if present
+func formatRow(row storage.DataRow) string {
+	line := row.ShortURL + " -> " + row.OriginalURL
+	if row.Title != "" {
+		line += " \"" + row.Title + "\""
+	}
+	if len(row.Tags) > 0 {
+		line += " [" + strings.Join(row.Tags, ",") + "]"
+	}
+	return line
+}
+
+// jsonRowWriter writes records as a single JSON array
+type jsonRowWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonRowWriter) WriteRow(row storage.DataRow) error {
+	prefix := ","
+	if j.count == 0 {
+		prefix = "["
+	}
+	j.count++
+	rowBytes, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(j.w, prefix+string(rowBytes))
+	return err
+}
+
+func (j *jsonRowWriter) Close() error {
+	suffix := "]"
+	if j.count == 0 {
+		suffix = "[]"
+	}
+	_, err := io.WriteString(j.w, suffix+"\n")
+	return err
+}
+
+// ndjsonRowWriter writes records as newline delimited JSON, one DataRow per line
+type ndjsonRowWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonRowWriter) WriteRow(row storage.DataRow) error {
+	return n.encoder.Encode(&row)
+}
+
+func (n *ndjsonRowWriter) Close() error {
+	return nil
+}
+
+// csvRowWriter writes records as CSV with a header line
+type csvRowWriter struct {
+	w       *csv.Writer
+	started bool
+}
+
+func (c *csvRowWriter) WriteRow(row storage.DataRow) error {
+	if !c.started {
+		c.started = true
+		if err := c.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	record := []string{
+		strconv.FormatInt(row.UUID, 10),
+		row.ShortURL,
+		row.OriginalURL,
+		formatTime(row.CreatedAt),
+		formatInt(row.RedirectCode),
+		strconv.FormatBool(row.Passthrough),
+		formatTime(row.ExpiresAt),
+		row.Title,
+		strings.Join(row.Tags, ","),
+		row.Notes,
+	}
+	if err := c.w.Write(record); err != nil {
+		return err
+	}
+	// flush every row to the underlying writer, which is flushed by flushingRowWriter
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvRowWriter) Close() error {
+	if !c.started {
+		c.started = true
+		if err := c.w.Write(csvColumns); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// formatTime formats an optional time as RFC 3339, zero or nil time gives ""
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// formatInt formats an optional int, zero gives ""
+func formatInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNegotiateContentType tests the negotiateContentType function
+func TestNegotiateContentType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: contentTypeText},
+		{accept: "*/*", want: contentTypeText},
+		{accept: "application/json", want: contentTypeJSON},
+		{accept: "text/csv; charset=utf-8", want: contentTypeCSV},
+		{accept: "text/html, application/x-ndjson;q=0.9, */*;q=0.8", want: contentTypeNDJSON},
+		{accept: "image/png", want: ""},
+		{accept: "text/csv;q=0.1, application/json", want: contentTypeJSON},
+		{accept: "application/json;q=0.5, text/csv;q=0.5", want: contentTypeJSON},
+		{accept: "application/json;q=0", want: ""},
+		{accept: "*/*;q=0.9, text/plain;q=0", want: ""},
+		{accept: "text/csv;q=abc, application/x-ndjson;q=0.2", want: contentTypeNDJSON},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, negotiateContentType(tt.accept), tt.accept)
+	}
+}
+
+// TestListURLHandlerFormats tests the content negotiation of the list endpoint
+func TestListURLHandlerFormats(t *testing.T) {
+	setupListStore(t)
+	store.AddRow(storage.DataRow{ShortURL: "hash1", OriginalURL: "https://example.com/1", Tags: []string{"a", "b"}})
+	store.AddRow(storage.DataRow{ShortURL: "hash2", OriginalURL: "https://example.com/2"})
+
+	tests := []struct {
+		name   string
+		accept string
+		code   int
+		check  func(t *testing.T, body string)
+	}{
+		{
+			name: "Plain text",
+			code: http.StatusOK,
+			check: func(t *testing.T, body string) {
+				assert.Equal(t, "hash1 -> https://example.com/1 [a,b]\nhash2 -> https://example.com/2\n", body)
+			},
+		},
+		{
+			name:   "JSON",
+			accept: contentTypeJSON,
+			code:   http.StatusOK,
+			check: func(t *testing.T, body string) {
+				var rows []storage.DataRow
+				require.NoError(t, json.Unmarshal([]byte(body), &rows))
+				require.Len(t, rows, 2)
+				assert.Equal(t, []string{"a", "b"}, rows[0].Tags)
+			},
+		},
+		{
+			name:   "NDJSON",
+			accept: contentTypeNDJSON,
+			code:   http.StatusOK,
+			check: func(t *testing.T, body string) {
+				lines := strings.Split(strings.TrimSpace(body), "\n")
+				require.Len(t, lines, 2)
+				var row storage.DataRow
+				require.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+				assert.Equal(t, "hash2", row.ShortURL)
+			},
+		},
+		{
+			name:   "CSV",
+			accept: contentTypeCSV,
+			code:   http.StatusOK,
+			check: func(t *testing.T, body string) {
+				lines := strings.Split(strings.TrimSpace(body), "\n")
+				require.Len(t, lines, 3)
+				assert.Equal(t, strings.Join(csvColumns, ","), lines[0])
+				assert.True(t, strings.HasPrefix(lines[1], "1,hash1,https://example.com/1,"), lines[1])
+			},
+		},
+		{
+			name:   "Not acceptable",
+			accept: "image/png",
+			code:   http.StatusNotAcceptable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/list", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			res := httptest.NewRecorder()
+
+			ListURLHandler(res, req)
+
+			result := res.Result()
+			defer result.Body.Close()
+			require.Equal(t, tt.code, result.StatusCode)
+			if tt.check != nil {
+				assert.True(t, strings.HasPrefix(result.Header.Get("Content-Type"), negotiateContentType(tt.accept)))
+				assert.True(t, res.Flushed)
+				tt.check(t, res.Body.String())
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 )
 
 // Store URL storage
@@ -27,7 +28,13 @@ func SetStore(s storage.Storage) {
 
 // POST structure of the request body
 type shortenRequest struct {
-	URL string `json:"url"`
+	URL          string   `json:"url"`
+	RedirectCode int      `json:"redirect_code,omitempty"`
+	Passthrough  bool     `json:"passthrough,omitempty"`
+	UTM          string   `json:"utm,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Notes        string   `json:"notes,omitempty"`
 }
 
 // POST structure of the response body
@@ -43,9 +50,23 @@ func Router() chi.Router {
 	r.Use(middleware.WithLogging, middleware.WithCompressing)
 
 	// Routes
-	r.Post("/api/shorten", PostURLHandlerJSON)
-	r.Post("/", PostURLHandler)
+	r.Group(func(r chi.Router) {
+		// writes are forwarded to the primary or rejected on a read-only follower
+		r.Use(middleware.WithFollower(func() bool { return storage.IsReadOnly(store) }))
+		r.Post("/api/shorten", PostURLHandlerJSON)
+		r.With(middleware.WithAdminAuth).Post("/api/import", ImportHandler)
+		r.With(middleware.WithAdminAuth).Post("/api/compact", CompactHandler)
+		r.With(middleware.WithAdminAuth).Patch("/api/urls/{id}", PatchURLHandler)
+		r.Post("/", PostURLHandler)
+	})
+	r.With(middleware.WithAdminAuth).Get("/api/export", ExportHandler)
+	r.With(middleware.WithAdminAuth).Get("/api/cache", CacheStatsHandler)
+	r.With(middleware.WithAdminAuth).Post("/api/policy/reload", ReloadPolicyHandler)
+	r.Get("/api/urls", ListURLHandlerJSON)
+	r.Get("/api/utm", ListUTMTemplatesHandler)
+	r.With(middleware.WithAdminAuth).Post("/api/utm", PostUTMTemplateHandler)
 	r.Get("/{id}", GetURLHandler)
+	r.Get("/{id}/*", GetURLHandler)
 	r.Get("/list", ListURLHandler)
 	return r
 }
@@ -78,9 +99,31 @@ func PostURLHandlerJSON(res http.ResponseWriter, req *http.Request) {
 	}
 	log.Infof("URL received: %s", request.URL)
 	url := string(request.URL)
-	hash := getHash(url)
+	// rewrite the URL with the UTM template before hashing
+	if request.UTM != "" {
+		url, err = applyUTMTemplate(request.UTM, url)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	url, err = canonicalURL(url)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// a link to this shortener is replaced with its final target
+	url, err = resolveSelfURL(url)
+	if err != nil {
+		http.Error(res, err.Error(), selfLinkStatus(err))
+		return
+	}
+	if err := checkPolicy(url); err != nil {
+		http.Error(res, err.Error(), policyStatus(err))
+		return
+	}
 	// check if the URL already exists in the map
-	_, ok, err := store.GetURL(hash)
+	hash, ok, err := shortCode(store, url)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
@@ -89,7 +132,19 @@ func PostURLHandlerJSON(res http.ResponseWriter, req *http.Request) {
 		log.Infof("URL already exists in the map: url=%s; hash=%s", url, hash)
 	} else {
 		// Add new URL to the map
-		store.AddURL(hash, url)
+		row := storage.DataRow{
+			ShortURL:     hash,
+			OriginalURL:  url,
+			RedirectCode: request.RedirectCode,
+			Passthrough:  request.Passthrough,
+			Title:        request.Title,
+			Tags:         request.Tags,
+			Notes:        request.Notes,
+		}
+		if err := store.AddRow(row); err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		log.Infof("URL received and added to the map: url=%s; hash=%s", url, hash)
 	}
 	response := shortenResponse{Result: config.Config.BaseURL + "/" + hash}
@@ -105,7 +160,14 @@ func PostURLHandlerJSON(res http.ResponseWriter, req *http.Request) {
 
 // Validate checks if the required fields are present
 func (r *shortenRequest) Validate() error {
-	return ValidateURL(r.URL)
+	if err := ValidateURL(r.URL); err != nil {
+		return err
+	}
+	// zero means the global default is used
+	if r.RedirectCode != 0 {
+		return ValidateRedirectCode(r.RedirectCode)
+	}
+	return nil
 }
 
 // PostURLHandler Handle POST requests
@@ -128,9 +190,23 @@ func PostURLHandler(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, err.Error(), http.StatusBadRequest)
 		return
 	}
-	hash := getHash(bodyString)
+	bodyString, err = canonicalURL(bodyString)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// a link to this shortener is replaced with its final target
+	bodyString, err = resolveSelfURL(bodyString)
+	if err != nil {
+		http.Error(res, err.Error(), selfLinkStatus(err))
+		return
+	}
+	if err := checkPolicy(bodyString); err != nil {
+		http.Error(res, err.Error(), policyStatus(err))
+		return
+	}
 	// check if the URL already exists in the map
-	_, ok, err := store.GetURL(hash)
+	hash, ok, err := shortCode(store, bodyString)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
@@ -157,9 +233,10 @@ func GetURLHandler(res http.ResponseWriter, req *http.Request) {
 	}
 	// handle redirect request
 	id := parts[1]
+	suffix := strings.Join(parts[2:], "/")
 	log.Infof("Get Url shortcut: %s", id)
 	// return 404 if id not found
-	url, ok, err := store.GetURL(id)
+	row, ok, err := store.GetRow(id)
 	if err != nil {
 		http.Error(res, err.Error(), http.StatusInternalServerError)
 		return
@@ -169,14 +246,106 @@ func GetURLHandler(res http.ResponseWriter, req *http.Request) {
 		res.WriteHeader(http.StatusNotFound)
 		return
 	}
-	// return 307 status and Location header
-	log.Infof("Url found: %s", url)
-	//res.Header().Set("Location", url)
-	//res.WriteHeader(http.StatusTemporaryRedirect)
-	http.Redirect(res, req, url, http.StatusTemporaryRedirect)
+	if row.Expired(time.Now()) {
+		log.Infof("Url expired: %s", id)
+		res.WriteHeader(http.StatusGone)
+		return
+	}
+	target := row.OriginalURL
+	if row.Passthrough {
+		target, err = passthroughURL(target, suffix, req.URL.Query())
+		if errors.Is(err, errDotSegment) {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	} else if suffix != "" {
+		// suffix paths are only served for passthrough links
+		log.Infof("Url does not allow passthrough: %s", id)
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// links to this shortener stored before they were resolved on create
+	target, err = resolveSelfURL(target, id)
+	if errors.Is(err, ErrRedirectLoop) {
+		log.Infof("Url redirects to itself: %s", id)
+		http.Error(res, err.Error(), http.StatusLoopDetected)
+		return
+	}
+	if errors.Is(err, ErrSelfLink) {
+		log.Infof("Url target not found: %s", id)
+		res.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// links stored before the policy blocked their target are not followed
+	if err := checkPolicy(target); err != nil {
+		if policyStatus(err) == http.StatusUnprocessableEntity {
+			http.Error(res, err.Error(), http.StatusGone)
+			return
+		}
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// return redirect status and Location header
+	log.Infof("Url found: %s", target)
+	http.Redirect(res, req, target, redirectCode(row))
+}
+
+// errDotSegment is returned for a passthrough suffix climbing out of the target path
+var errDotSegment = errors.New("suffix path cannot contain . or .. segments")
+
+// passthroughURL merges the incoming suffix path and query into the target URL.
+// The suffix is appended to the target path; on parameter collision the
+// parameters stored in the target URL take precedence over the incoming ones.
+func passthroughURL(target, suffix string, query url.Values) (string, error) {
+	for _, segment := range strings.Split(suffix, "/") {
+		if segment == "." || segment == ".." {
+			return "", errDotSegment
+		}
+	}
+	parsedURL, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if suffix != "" {
+		parsedURL = parsedURL.JoinPath(suffix)
+	}
+	targetQuery := parsedURL.Query()
+	extra := url.Values{}
+	for key, values := range query {
+		if _, ok := targetQuery[key]; !ok {
+			extra[key] = values
+		}
+	}
+	if len(extra) > 0 {
+		if parsedURL.RawQuery != "" {
+			parsedURL.RawQuery += "&"
+		}
+		parsedURL.RawQuery += extra.Encode()
+	}
+	return parsedURL.String(), nil
 }
 
-// ListURLHandler Handle list URL requests
+// redirectCode returns the per-link redirect status code or the global default
+func redirectCode(row storage.DataRow) int {
+	if row.RedirectCode != 0 {
+		return row.RedirectCode
+	}
+	if config.Config.RedirectCode != 0 {
+		return config.Config.RedirectCode
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// ListURLHandler Handle list URL requests, optionally filtered by ?tag=.
+// The format is negotiated with the Accept header: plain text, JSON, CSV or NDJSON.
 func ListURLHandler(res http.ResponseWriter, req *http.Request) {
 	log.Infof("List Url shortcuts")
 	path := req.URL.Path
@@ -186,15 +355,36 @@ func ListURLHandler(res http.ResponseWriter, req *http.Request) {
 		// handle list request
 		id := parts[1]
 		if id == "list" {
-			res.Header().Set("Content-Type", "text/plain")
-			res.WriteHeader(http.StatusOK)
-			rows, err := store.GetAll()
-			if err != nil {
+			contentType := negotiateContentType(req.Header.Get("Accept"))
+			if contentType == "" {
+				res.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			tag := req.URL.Query().Get("tag")
+			res.Header().Set("Content-Type", contentType)
+			writer := newRowWriter(contentType, res)
+			// the status is sent with the first row, so errors before it are still reported
+			started := false
+			err := store.Range(0, false, func(row storage.DataRow) bool {
+				if tag != "" && !row.HasTag(tag) {
+					return true
+				}
+				started = true
+				if err := writer.WriteRow(row); err != nil {
+					log.Error(err)
+					return false
+				}
+				return true
+			})
+			if err != nil && !started {
 				http.Error(res, err.Error(), http.StatusInternalServerError)
 				return
 			}
-			for k, v := range rows {
-				res.Write([]byte(k + " -> " + v + "\n"))
+			if err != nil {
+				log.Error(err)
+			}
+			if err := writer.Close(); err != nil {
+				log.Error(err)
 			}
 			return
 		}
@@ -204,6 +394,48 @@ func ListURLHandler(res http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// maxHashProbes number of salted hashes tried when the URL hash is held by another URL
+const maxHashProbes = 16
+
+// shortCode returns the short code of the URL: its hash, or a salted hash when
+// the hash is held by another URL, e.g. after PATCH retargeted the link.
+// ok reports that the URL is stored under the code already.
+func shortCode(s storage.Storage, url string) (string, bool, error) {
+	for i := 0; i < maxHashProbes; i++ {
+		hash := probeHash(url, i)
+		row, ok, err := s.GetRow(hash)
+		if err != nil {
+			return "", false, err
+		}
+		if !ok {
+			return hash, false, nil
+		}
+		if row.OriginalURL == url {
+			return hash, true, nil
+		}
+	}
+	return "", false, fmt.Errorf("no free short code for %s", url)
+}
+
+// probeHash returns the hash of the URL for the first probe, a salted hash for the others
+func probeHash(url string, probe int) string {
+	if probe == 0 {
+		return getHash(url)
+	}
+	// a newline cannot occur in a valid URL, so the salted input is no other URL
+	return getHash(fmt.Sprintf("%s\n%d", url, probe))
+}
+
+// isHashOf checks if the short code is one of the hashes generated for the URL
+func isHashOf(code, url string) bool {
+	for i := 0; i < maxHashProbes; i++ {
+		if probeHash(url, i) == code {
+			return true
+		}
+	}
+	return false
+}
+
 // Compute SHA-256 hash of the body string
 func getHash(bodyString string) string {
 	hash := sha256.New()
@@ -229,14 +461,20 @@ func ValidateURL(value string) error {
 		log.Infof("Invalid URL format: %s", value)
 		return fmt.Errorf("invalid URL format: %v", err)
 	}
-	// check if scheme is HTTP or HTTPS
-	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
-		return errors.New("URL must start with http:// or https://")
-	}
-	// check if host is present
-	if parsedURL.Host == "" {
-		return errors.New("URL must contain a host")
+	// check if the scheme is allowed and the URL is valid for it
+	if err := validateScheme(parsedURL); err != nil {
+		return err
 	}
 	log.Infof("Valid URL: %s", value)
 	return nil
 }
+
+// ValidateRedirectCode Check if the status code belongs to the redirect family
+func ValidateRedirectCode(code int) error {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return nil
+	}
+	return fmt.Errorf("redirect code must be one of 301, 302, 303, 307, 308: got %d", code)
+}
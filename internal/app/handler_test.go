@@ -24,9 +24,20 @@ func setup() {
 	log.InitializeLogger()
 	defer log.Logger.Sync()
 
-	// init storage
-	store, _ := storage.NewFileStorage(config.Config.FileStoragePath)
-	SetStore(store)
+	// init storage, the previous one is closed to release its file lock
+	closeStore()
+	s, err := storage.NewFileStorage(config.Config.FileStoragePath)
+	if err != nil {
+		panic(err)
+	}
+	SetStore(s)
+}
+
+// closeStore closes the current store if it holds resources
+func closeStore() {
+	if closer, ok := store.(io.Closer); ok {
+		closer.Close()
+	}
 }
 
 // TestPostURLHandlerJSON tests the PostURLHandlerJSON function
@@ -108,6 +119,25 @@ func TestPostURLHandlerJSON(t *testing.T) {
 				body: "URL must start with http:// or https://\n",
 			},
 		},
+		{
+			name:   "Valid redirect code",
+			method: "POST",
+			body:   `{"url": "https://example.com/permanent", "redirect_code": 301}`,
+			want: want{
+				code:        http.StatusCreated,
+				body:        "http://localhost:8080/",
+				contentType: "application/json",
+			},
+		},
+		{
+			name:   "Wrong redirect code",
+			method: "POST",
+			body:   `{"url": "https://example.com", "redirect_code": 200}`,
+			want: want{
+				code: http.StatusBadRequest,
+				body: "redirect code must be one of 301, 302, 303, 307, 308: got 200\n",
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -271,6 +301,167 @@ func TestGetURLHandler(t *testing.T) {
 	}
 }
 
+// TestGetURLHandlerRedirectCode tests the per-link and global redirect status codes
+func TestGetURLHandlerRedirectCode(t *testing.T) {
+	setup()
+	defer func() { config.Config.RedirectCode = 0 }()
+
+	store.AddRow(storage.DataRow{ShortURL: "redir301", OriginalURL: "https://example.com/301", RedirectCode: 301})
+	store.AddRow(storage.DataRow{ShortURL: "redirdef", OriginalURL: "https://example.com/default"})
+
+	tests := []struct {
+		name           string
+		path           string
+		globalCode     int
+		expectedStatus int
+	}{
+		{
+			name:           "Fallback without global default",
+			path:           "/redirdef",
+			expectedStatus: http.StatusTemporaryRedirect,
+		},
+		{
+			name:           "Global default",
+			path:           "/redirdef",
+			globalCode:     http.StatusFound,
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "Per-link override",
+			path:           "/redir301",
+			globalCode:     http.StatusFound,
+			expectedStatus: http.StatusMovedPermanently,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.RedirectCode = tt.globalCode
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			res := httptest.NewRecorder()
+
+			GetURLHandler(res, req)
+
+			result := res.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+		})
+	}
+}
+
+// TestGetURLHandlerPassthrough tests query string and path passthrough on redirect
+func TestGetURLHandlerPassthrough(t *testing.T) {
+	setup()
+
+	store.AddRow(storage.DataRow{ShortURL: "passthru", OriginalURL: "https://example.com/land?utm_source=site", Passthrough: true})
+	store.AddRow(storage.DataRow{ShortURL: "nopassth", OriginalURL: "https://example.com/land"})
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedHeader string
+	}{
+		{
+			name:           "Passthrough query",
+			path:           "/passthru?ref=mail",
+			expectedStatus: http.StatusTemporaryRedirect,
+			expectedHeader: "https://example.com/land?utm_source=site&ref=mail",
+		},
+		{
+			name:           "Passthrough query collision keeps target parameter",
+			path:           "/passthru?utm_source=mail&ref=mail",
+			expectedStatus: http.StatusTemporaryRedirect,
+			expectedHeader: "https://example.com/land?utm_source=site&ref=mail",
+		},
+		{
+			name:           "Passthrough suffix path",
+			path:           "/passthru/extra/path",
+			expectedStatus: http.StatusTemporaryRedirect,
+			expectedHeader: "https://example.com/land/extra/path?utm_source=site",
+		},
+		{
+			name:           "Passthrough suffix with dot segments rejected",
+			path:           "/passthru/../../admin",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Passthrough suffix with encoded dot segments rejected",
+			path:           "/passthru/extra/%2e%2e/%2E%2E/admin",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Passthrough suffix with current segment rejected",
+			path:           "/passthru/./extra",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Query ignored without passthrough",
+			path:           "/nopassth?ref=mail",
+			expectedStatus: http.StatusTemporaryRedirect,
+			expectedHeader: "https://example.com/land",
+		},
+		{
+			name:           "Suffix path rejected without passthrough",
+			path:           "/nopassth/extra",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			res := httptest.NewRecorder()
+
+			GetURLHandler(res, req)
+
+			result := res.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.expectedStatus, result.StatusCode)
+			assert.Equal(t, tt.expectedHeader, result.Header.Get("Location"))
+		})
+	}
+}
+
+// TestListURLHandlerTagFilter tests the link metadata and the tag filter of the list
+func TestListURLHandlerTagFilter(t *testing.T) {
+	setup()
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, http.MethodPost, "/api/shorten",
+		`{"url": "https://example.com/promo", "title": "Promo", "tags": ["promo", "spring"], "notes": "landing"}`)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	row, ok, err := store.GetRow(getHash("https://example.com/promo"))
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "landing", row.Notes)
+
+	resp, body := testRequest(t, ts, http.MethodGet, "/list?tag=promo", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+		assert.True(t, strings.HasSuffix(line, `"Promo" [promo,spring]`), line)
+	}
+
+	resp, body = testRequest(t, ts, http.MethodGet, "/list?tag=nonexistent", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "", body)
+}
+
+// TestValidateRedirectCode tests the ValidateRedirectCode function
+func TestValidateRedirectCode(t *testing.T) {
+	for _, code := range []int{301, 302, 303, 307, 308} {
+		assert.NoError(t, ValidateRedirectCode(code))
+	}
+	for _, code := range []int{0, 200, 300, 304, 404} {
+		assert.Error(t, ValidateRedirectCode(code))
+	}
+}
+
 // TestRouter tests the Router function
 func TestRouter(t *testing.T) {
 	setup()
@@ -335,6 +526,14 @@ func TestRouter(t *testing.T) {
 				code: http.StatusNotFound,
 			},
 		},
+		{
+			name:   "GET request with suffix path without passthrough",
+			url:    "/12345678/extra",
+			method: "GET",
+			want: want{
+				code: http.StatusNotFound,
+			},
+		},
 		{
 			name:   "Non-GET request method",
 			url:    "/12345678",
@@ -0,0 +1,327 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxImportSize largest accepted multipart import body
+const maxImportSize = 64 << 20
+
+// shortCodePattern allowed characters of a supplied short code
+var shortCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// hashCodePattern format of the short codes generated from URL hashes
+var hashCodePattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// reservedShortCodes short codes shadowed by the router
+var reservedShortCodes = map[string]bool{"api": true, "list": true}
+
+// ImportReport result of a bulk import
+type ImportReport struct {
+	Imported int           `json:"imported"`
+	Skipped  int           `json:"skipped"`
+	Failed   int           `json:"failed"`
+	Errors   []ImportError `json:"errors,omitempty"`
+	// Error read error which aborted the import, the counters cover the rows before it
+	Error string `json:"error,omitempty"`
+}
+
+// ImportError failure of a single imported row
+type ImportError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportFormat returns the import format of a content type or a file name
+func ImportFormat(contentType, filename string) (string, error) {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mediaType {
+		case contentTypeCSV, contentTypeNDJSON:
+			return mediaType, nil
+		}
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return contentTypeCSV, nil
+	case ".ndjson", ".jsonl":
+		return contentTypeNDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported import format: %s %s", contentType, filename)
+}
+
+// ImportRows imports CSV or NDJSON records into the storage. Invalid rows are
+// reported in the result and do not abort the import; only read errors do.
+func ImportRows(s storage.Storage, r io.Reader, format string) (ImportReport, error) {
+	var report ImportReport
+	handle := func(line int, row storage.DataRow, err error) {
+		if err == nil {
+			var imported bool
+			imported, err = importRow(s, row)
+			if err == nil && imported {
+				report.Imported++
+			} else if err == nil {
+				report.Skipped++
+			}
+		}
+		if err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, ImportError{Line: line, Error: err.Error()})
+		}
+	}
+	switch format {
+	case contentTypeCSV:
+		return report, readCSVRows(r, handle)
+	case contentTypeNDJSON:
+		return report, readNDJSONRows(r, handle)
+	}
+	return report, fmt.Errorf("unsupported import format: %s", format)
+}
+
+// importRow validates and stores a single record, returns false for already existing records
+func importRow(s storage.Storage, row storage.DataRow) (bool, error) {
+	if err := ValidateURL(row.OriginalURL); err != nil {
+		return false, err
+	}
+	var err error
+	if row.OriginalURL, err = canonicalURL(row.OriginalURL); err != nil {
+		return false, err
+	}
+	if row.OriginalURL, err = resolveSelfURL(row.OriginalURL); err != nil {
+		return false, err
+	}
+	if err := checkPolicy(row.OriginalURL); err != nil {
+		return false, err
+	}
+	if row.RedirectCode != 0 {
+		if err := ValidateRedirectCode(row.RedirectCode); err != nil {
+			return false, err
+		}
+	}
+	// the supplied short code is preserved, a code taken by another URL is a conflict;
+	// rows without a short code get the URL hash like shortened URLs
+	var hash string
+	if row.ShortURL != "" {
+		if err := ValidateShortCode(row.ShortURL, row.OriginalURL); err != nil {
+			return false, err
+		}
+		hash = row.ShortURL
+		existing, ok, err := s.GetRow(hash)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			if existing.OriginalURL == row.OriginalURL {
+				return false, nil
+			}
+			return false, fmt.Errorf("short code already taken: %s", hash)
+		}
+	} else {
+		var ok bool
+		if hash, ok, err = shortCode(s, row.OriginalURL); err != nil || ok {
+			return false, err
+		}
+	}
+	// the storage fields of the input are not trusted
+	row.UUID = 0
+	row.ShortURL = hash
+	row.History = nil
+	row.KeyID = ""
+	row.CRC = 0
+	if err := s.AddRow(row); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ValidateShortCode Check if the supplied short code can be used for the URL.
+// Codes in the format of URL hashes are only accepted as a hash of the URL
+// itself, so a hash of another URL cannot be registered before it is shortened.
+func ValidateShortCode(value, url string) error {
+	if !shortCodePattern.MatchString(value) {
+		return fmt.Errorf("invalid short code: %s", value)
+	}
+	if reservedShortCodes[value] {
+		return fmt.Errorf("reserved short code: %s", value)
+	}
+	if hashCodePattern.MatchString(value) && !isHashOf(value, url) {
+		return fmt.Errorf("short code in the format of generated codes: %s", value)
+	}
+	return nil
+}
+
+// readCSVRows reads CSV records with a header naming the DataRow fields
+func readCSVRows(r io.Reader, fn func(line int, row storage.DataRow, err error)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("unable to read CSV header: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return errors.New("CSV header must contain original_url")
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		// malformed records are reported, the reader continues with the next one
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			fn(parseErr.StartLine, storage.DataRow{}, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		line, _ := reader.FieldPos(0)
+		row, err := parseCSVRecord(columns, record)
+		fn(line, row, err)
+	}
+}
+
+// parseCSVRecord converts a CSV record to a DataRow
+func parseCSVRecord(columns map[string]int, record []string) (storage.DataRow, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	row := storage.DataRow{
+		ShortURL:    get("short_url"),
+		OriginalURL: get("original_url"),
+		Title:       get("title"),
+		Notes:       get("notes"),
+	}
+	if tags := get("tags"); tags != "" {
+		row.Tags = strings.Split(tags, ",")
+	}
+	if value := get("redirect_code"); value != "" {
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			return row, fmt.Errorf("invalid redirect_code: %s", value)
+		}
+		row.RedirectCode = code
+	}
+	if value := get("passthrough"); value != "" {
+		passthrough, err := strconv.ParseBool(value)
+		if err != nil {
+			return row, fmt.Errorf("invalid passthrough: %s", value)
+		}
+		row.Passthrough = passthrough
+	}
+	if value := get("created_at"); value != "" {
+		createdAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return row, fmt.Errorf("invalid created_at: %s", value)
+		}
+		row.CreatedAt = &createdAt
+	}
+	if value := get("expires_at"); value != "" {
+		expiresAt, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return row, fmt.Errorf("invalid expires_at: %s", value)
+		}
+		row.ExpiresAt = &expiresAt
+	}
+	return row, nil
+}
+
+// readNDJSONRows reads newline delimited DataRow records, blank lines are ignored
+func readNDJSONRows(r io.Reader, fn func(line int, row storage.DataRow, err error)) error {
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(data))) > 0 {
+			var row storage.DataRow
+			decodeErr := json.Unmarshal(data, &row)
+			fn(line, row, decodeErr)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportHandler Handle multipart bulk import of CSV or NDJSON files
+func ImportHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("POST /api/import")
+	req.Body = http.MaxBytesReader(res, req.Body, maxImportSize)
+	file, err := importFilePart(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	format, err := ImportFormat(file.Header.Get("Content-Type"), file.FileName())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// the rows are imported while the body is read, so a read error midway
+	// is reported together with the rows already imported
+	status := http.StatusOK
+	report, err := ImportRows(store, file, format)
+	if err != nil {
+		log.Error(err)
+		report.Error = err.Error()
+		status = http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+	}
+	log.Infof("Import finished: imported=%d; skipped=%d; failed=%d", report.Imported, report.Skipped, report.Failed)
+	responseBytes, err := json.Marshal(report)
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	res.Write(responseBytes)
+}
+
+// importFilePart returns the "file" part of a multipart request without buffering the body
+func importFilePart(req *http.Request) (*multipart.Part, error) {
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no file in the import request")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
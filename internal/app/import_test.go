@@ -0,0 +1,183 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestImportRowsCSV tests the CSV import with per-row failures
+func TestImportRowsCSV(t *testing.T) {
+	setupListStore(t)
+	store.AddRow(storage.DataRow{ShortURL: "taken", OriginalURL: "https://example.com/taken"})
+
+	input := strings.Join([]string{
+		"short_url,original_url,title,tags",
+		"promo,https://example.com/promo,Promo,\"a,b\"",
+		",https://example.com/generated,,",
+		"taken,https://example.com/other,,",
+		"taken,https://example.com/taken,,",
+		"bad code,https://example.com/bad,,",
+		"list,https://example.com/reserved,,",
+		",111,,",
+	}, "\n")
+	report, err := ImportRows(store, strings.NewReader(input), contentTypeCSV)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 4, report.Failed)
+	require.Len(t, report.Errors, 4)
+	assert.Equal(t, ImportError{Line: 4, Error: "short code already taken: taken"}, report.Errors[0])
+	assert.Equal(t, 8, report.Errors[3].Line)
+
+	row, ok, err := store.GetRow("promo")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "Promo", row.Title)
+	assert.Equal(t, []string{"a", "b"}, row.Tags)
+
+	// the taken short code is a conflict, not a fallback to the URL hash
+	_, ok, err = store.GetURL(getHash("https://example.com/other"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+// TestImportRowsNDJSON tests the NDJSON import
+func TestImportRowsNDJSON(t *testing.T) {
+	setupListStore(t)
+
+	input := `{"short_url": "nd1", "original_url": "https://example.com/nd1", "redirect_code": 301}
+
+{"short_url": "nd2", "original_url": "https://example.com/nd2", "redirect_code": 200}
+{"short_url": "nd3", "original_url"
+`
+	report, err := ImportRows(store, strings.NewReader(input), contentTypeNDJSON)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, []int{3, 4}, []int{report.Errors[0].Line, report.Errors[1].Line})
+
+	row, ok, err := store.GetRow("nd1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, 301, row.RedirectCode)
+}
+
+// TestImportHandler tests the multipart import endpoint
+func TestImportHandler(t *testing.T) {
+	setupListStore(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "links.csv")
+	require.NoError(t, err)
+	part.Write([]byte("original_url\nhttps://example.com/multipart\n111\n"))
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/import", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+
+	ImportHandler(res, req)
+
+	result := res.Result()
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	var report ImportReport
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&report))
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 1, report.Failed)
+}
+
+// TestImportHandlerPartial tests that a body read failure returns the partial report
+func TestImportHandlerPartial(t *testing.T) {
+	setupListStore(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "links.csv")
+	require.NoError(t, err)
+	part.Write([]byte("original_url\nhttps://example.com/partial1\nhttps://example.com/partial2\n"))
+	// the body ends without the closing boundary
+	truncated := body.String()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(truncated))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	res := httptest.NewRecorder()
+
+	ImportHandler(res, req)
+
+	result := res.Result()
+	defer result.Body.Close()
+	require.Equal(t, http.StatusBadRequest, result.StatusCode)
+	var report ImportReport
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&report))
+	assert.Equal(t, 2, report.Imported)
+	assert.NotEmpty(t, report.Error)
+
+	_, ok, err := store.GetURL(getHash("https://example.com/partial2"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+}
+
+// TestImportRowsHashCodes tests that hashes of other URLs cannot be imported as short codes
+func TestImportRowsHashCodes(t *testing.T) {
+	setupListStore(t)
+
+	victim := "https://example.com/victim"
+	input := strings.Join([]string{
+		"short_url,original_url",
+		getHash(victim) + ",https://attacker.example.com/",
+		getHash("https://example.com/own") + ",https://example.com/own",
+	}, "\n")
+	report, err := ImportRows(store, strings.NewReader(input), contentTypeCSV)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Imported)
+	require.Len(t, report.Errors, 1)
+	assert.Equal(t, 2, report.Errors[0].Line)
+
+	hash, ok, err := shortCode(store, victim)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, getHash(victim), hash)
+}
+
+// TestImportHandlerAuth tests that only admins can import
+func TestImportHandlerAuth(t *testing.T) {
+	setupListStore(t)
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	resp, _ := testRequest(t, ts, http.MethodPost, "/api/import", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	resp, _ = testRequest(t, ts, http.MethodPost, "/api/import", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+// TestImportRowsKeyID tests that storage fields of the input are not imported
+func TestImportRowsKeyID(t *testing.T) {
+	setupListStore(t)
+
+	input := `{"short_url": "evil", "original_url": "https://example.com/x", "key_id": "k1", "crc": 1}` + "\n"
+	report, err := ImportRows(store, strings.NewReader(input), contentTypeNDJSON)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Imported)
+
+	row, ok, err := store.GetRow("evil")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Empty(t, row.KeyID)
+	assert.Zero(t, row.CRC)
+}
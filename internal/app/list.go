@@ -0,0 +1,123 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// defaultListLimit page size used when ?limit= is absent
+	defaultListLimit = 100
+	// maxListLimit largest accepted page size
+	maxListLimit = 1000
+)
+
+// GET structure of the list response body
+type listResponse struct {
+	Items      []storage.DataRow `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// listQuery parsed parameters of the list request
+type listQuery struct {
+	Cursor int64
+	Limit  int
+	Desc   bool
+	Prefix string
+	Search string
+	Tag    string
+}
+
+// parseListQuery parses and validates the list request parameters
+func parseListQuery(req *http.Request) (listQuery, error) {
+	values := req.URL.Query()
+	query := listQuery{
+		Limit:  defaultListLimit,
+		Prefix: values.Get("prefix"),
+		Search: values.Get("q"),
+		Tag:    values.Get("tag"),
+	}
+	if value := values.Get("cursor"); value != "" {
+		cursor, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || cursor < 0 {
+			return query, fmt.Errorf("invalid cursor: %s", value)
+		}
+		query.Cursor = cursor
+	}
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxListLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d: %s", maxListLimit, value)
+		}
+		query.Limit = limit
+	}
+	// the records are listed in insertion (UUID) order; imported and migrated
+	// records keep their created_at but are inserted when they are loaded
+	switch values.Get("sort") {
+	case "", "uuid":
+	case "-uuid":
+		query.Desc = true
+	default:
+		return query, fmt.Errorf("sort must be uuid or -uuid: %s", values.Get("sort"))
+	}
+	return query, nil
+}
+
+// Match checks if the record satisfies the filters of the query
+func (q *listQuery) Match(row *storage.DataRow) bool {
+	if q.Prefix != "" && !strings.HasPrefix(row.OriginalURL, q.Prefix) {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(row.OriginalURL, q.Search) {
+		return false
+	}
+	if q.Tag != "" && !row.HasTag(q.Tag) {
+		return false
+	}
+	return true
+}
+
+// ListURLHandlerJSON Handle paginated list requests with JSON response
+func ListURLHandlerJSON(res http.ResponseWriter, req *http.Request) {
+	log.Infof("GET /api/urls")
+	query, err := parseListQuery(req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// read one extra row to know whether there is a next page
+	response := listResponse{Items: make([]storage.DataRow, 0, query.Limit)}
+	more := false
+	err = store.Range(query.Cursor, query.Desc, func(row storage.DataRow) bool {
+		if !query.Match(&row) {
+			return true
+		}
+		if len(response.Items) == query.Limit {
+			more = true
+			return false
+		}
+		response.Items = append(response.Items, row)
+		return true
+	})
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if more {
+		last := response.Items[len(response.Items)-1]
+		response.NextCursor = strconv.FormatInt(last.UUID, 10)
+	}
+	responseBytes, err := json.Marshal(response)
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseBytes)
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupListStore replaces the store with an empty temporary file storage
+func setupListStore(t *testing.T) {
+	setup()
+	closeStore()
+	file, err := os.CreateTemp("", "list_test.json")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(file.Name())
+		os.Remove(file.Name() + ".lock")
+	})
+	s, err := storage.NewFileStorage(file.Name())
+	require.NoError(t, err)
+	SetStore(s)
+}
+
+// TestListURLHandlerJSON tests the ListURLHandlerJSON function
+func TestListURLHandlerJSON(t *testing.T) {
+	setupListStore(t)
+	for i := 1; i <= 5; i++ {
+		store.AddRow(storage.DataRow{
+			ShortURL:    fmt.Sprintf("hash%d", i),
+			OriginalURL: fmt.Sprintf("https://example%d.com/page", i%2),
+		})
+	}
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		url        string
+		code       int
+		hashes     []string
+		nextCursor string
+	}{
+		{
+			name:       "First page",
+			url:        "/api/urls?limit=2",
+			code:       http.StatusOK,
+			hashes:     []string{"hash1", "hash2"},
+			nextCursor: "2",
+		},
+		{
+			name:   "Last page",
+			url:    "/api/urls?limit=2&cursor=4",
+			code:   http.StatusOK,
+			hashes: []string{"hash5"},
+		},
+		{
+			name:       "Descending order",
+			url:        "/api/urls?limit=2&sort=-uuid",
+			code:       http.StatusOK,
+			hashes:     []string{"hash5", "hash4"},
+			nextCursor: "4",
+		},
+		{
+			name:   "Prefix search",
+			url:    "/api/urls?prefix=https://example0",
+			code:   http.StatusOK,
+			hashes: []string{"hash2", "hash4"},
+		},
+		{
+			name:   "Substring search",
+			url:    "/api/urls?q=example1",
+			code:   http.StatusOK,
+			hashes: []string{"hash1", "hash3", "hash5"},
+		},
+		{
+			name: "Wrong limit",
+			url:  "/api/urls?limit=0",
+			code: http.StatusBadRequest,
+		},
+		{
+			name: "Wrong sort",
+			url:  "/api/urls?sort=url",
+			code: http.StatusBadRequest,
+		},
+		{
+			// the order is the insertion order, not the creation time
+			name: "Creation time sort",
+			url:  "/api/urls?sort=created_at",
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := testRequest(t, ts, http.MethodGet, tt.url, "")
+			defer resp.Body.Close()
+			require.Equal(t, tt.code, resp.StatusCode)
+			if tt.code != http.StatusOK {
+				return
+			}
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+			var response listResponse
+			require.NoError(t, json.Unmarshal([]byte(body), &response))
+			hashes := make([]string, 0, len(response.Items))
+			for _, row := range response.Items {
+				hashes = append(hashes, row.ShortURL)
+			}
+			assert.Equal(t, tt.hashes, hashes)
+			assert.Equal(t, tt.nextCursor, response.NextCursor)
+		})
+	}
+}
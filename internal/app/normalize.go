@@ -0,0 +1,79 @@
+package app
+
+import (
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts ports implied by the URL scheme
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// canonicalURL returns the normalized URL when normalization is enabled,
+// so equivalent URLs get the same short link
+func canonicalURL(value string) (string, error) {
+	if !config.Config.NormalizeURLs {
+		return value, nil
+	}
+	return NormalizeURL(value)
+}
+
+// NormalizeURL returns the canonical form of a valid URL: the scheme and host
+// are lowercased, an internationalized host is converted to punycode, the
+// default port is removed, an empty HTTP path becomes "/" and the query
+// parameters are sorted by name keeping the order of repeated ones. Non-empty
+// paths keep their trailing slash, servers may treat /a and /a/ differently.
+func NormalizeURL(value string) (string, error) {
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return "", err
+	}
+	parsedURL.Scheme = strings.ToLower(parsedURL.Scheme)
+	host := toASCIIHost(parsedURL.Hostname())
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port := parsedURL.Port(); port != "" && port != defaultPorts[parsedURL.Scheme] {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	parsedURL.Host = host
+	if _, ok := defaultPorts[parsedURL.Scheme]; ok && parsedURL.Path == "" && parsedURL.Opaque == "" {
+		parsedURL.Path = "/"
+	}
+	parsedURL.RawQuery = sortQuery(parsedURL.RawQuery)
+	parsedURL.ForceQuery = false
+	return parsedURL.String(), nil
+}
+
+// sortQuery sorts the raw query parameters by name without re-encoding them,
+// empty parameters are dropped
+func sortQuery(rawQuery string) string {
+	params := make([]string, 0, strings.Count(rawQuery, "&")+1)
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		nameI, _, _ := strings.Cut(params[i], "=")
+		nameJ, _, _ := strings.Cut(params[j], "=")
+		return nameI < nameJ
+	})
+	return strings.Join(params, "&")
+}
+
+// toASCIIHost converts an internationalized host to its ASCII form with the
+// IDNA lookup mapping, IP addresses and hosts IDNA rejects are only lowercased
+func toASCIIHost(host string) string {
+	if net.ParseIP(host) != nil {
+		return strings.ToLower(host)
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return strings.ToLower(host)
+	}
+	return ascii
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNormalizeURL tests the NormalizeURL function
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{url: "HTTP://Example.COM", want: "http://example.com/"},
+		{url: "http://example.com/", want: "http://example.com/"},
+		{url: "http://example.com:80", want: "http://example.com/"},
+		{url: "https://example.com:443/a/", want: "https://example.com/a/"},
+		{url: "https://example.com:8443/a", want: "https://example.com:8443/a"},
+		{url: "http://[::1]:80/", want: "http://[::1]/"},
+		{url: "http://[::1]:8080/", want: "http://[::1]:8080/"},
+		{url: "http://example.com/?b=2&a=1&b=1&", want: "http://example.com/?a=1&b=2&b=1"},
+		{url: "http://example.com/?", want: "http://example.com/"},
+		{url: "http://example.com/p?q=a%20b#Frag", want: "http://example.com/p?q=a%20b#Frag"},
+		{url: "http://user@Example.com/", want: "http://user@example.com/"},
+		{url: "http://Bücher.example/", want: "http://xn--bcher-kva.example/"},
+		{url: "https://пример.рф/", want: "https://xn--e1afmkfd.xn--p1ai/"},
+		{url: "http://münchen.de:80", want: "http://xn--mnchen-3ya.de/"},
+		{url: "http://ＥＸＡＭＰＬＥ．com/", want: "http://example.com/"},
+		{url: "http://MÜNCHEN.de/", want: "http://xn--mnchen-3ya.de/"},
+		{url: "http://my_host.example/", want: "http://my_host.example/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			got, err := NormalizeURL(tt.url)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// TestPostURLHandlerNormalized tests that equivalent URLs get the same short link
+func TestPostURLHandlerNormalized(t *testing.T) {
+	setup()
+	config.Config.NormalizeURLs = true
+	defer func() { config.Config.NormalizeURLs = false }()
+
+	for _, body := range []string{"HTTP://Example.com/norm?b=1&a=2", "http://example.com:80/norm?a=2&b=1"} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		PostURLHandler(res, req)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		assert.Equal(t, config.Config.BaseURL+"/"+getHash("http://example.com/norm?a=2&b=1"), res.Body.String())
+	}
+	url, ok, err := store.GetURL(getHash("http://example.com/norm?a=2&b=1"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example.com/norm?a=2&b=1", url)
+}
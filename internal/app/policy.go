@@ -0,0 +1,205 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// types of policy rules
+const (
+	// ruleDomain matches the host exactly
+	ruleDomain = "domain"
+	// ruleSuffix matches the host and its subdomains
+	ruleSuffix = "suffix"
+	// ruleRegex matches the whole target URL
+	ruleRegex = "regex"
+)
+
+// PolicyRule rule matching target URLs
+type PolicyRule struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	re    *regexp.Regexp
+}
+
+// Policy rules deciding which target URLs may be shortened
+type Policy struct {
+	// AllowlistOnly rejects targets matching no allow rule
+	AllowlistOnly bool         `json:"allowlist_only"`
+	Block         []PolicyRule `json:"block"`
+	Allow         []PolicyRule `json:"allow"`
+}
+
+// PolicyError target URL rejected by the policy
+type PolicyError struct {
+	// Rule the rule that matched, "allowlist" if no allow rule matched
+	Rule string
+}
+
+// Error returns the message with the matched rule
+func (e *PolicyError) Error() string {
+	return "target URL rejected by policy rule " + e.Rule
+}
+
+// policy current policy, nil allows all targets
+var policy = struct {
+	mu sync.RWMutex
+	p  *Policy
+}{}
+
+// LoadPolicy loads the policy from a JSON file and replaces the current one,
+// the current policy is kept if the file is invalid
+func LoadPolicy(filename string) (*Policy, error) {
+	log.Infof("Loading policy: %s", filename)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+	SetPolicy(&p)
+	log.Infof("Policy loaded: block=%d; allow=%d; allowlist_only=%t", len(p.Block), len(p.Allow), p.AllowlistOnly)
+	return &p, nil
+}
+
+// SetPolicy replaces the current policy, nil allows all targets
+func SetPolicy(p *Policy) {
+	policy.mu.Lock()
+	defer policy.mu.Unlock()
+	policy.p = p
+}
+
+// Compile validates the rules and prepares them for matching
+func (p *Policy) Compile() error {
+	for _, rules := range [][]PolicyRule{p.Block, p.Allow} {
+		for i := range rules {
+			if err := rules[i].compile(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compile validates the rule, hosts are compared lowercased and in punycode
+func (r *PolicyRule) compile() error {
+	if r.Value == "" {
+		return errors.New("policy rule value cannot be empty")
+	}
+	switch r.Type {
+	case ruleDomain, ruleSuffix:
+		r.Value = toASCIIHost(strings.Trim(strings.ToLower(r.Value), "."))
+	case ruleRegex:
+		re, err := regexp.Compile(r.Value)
+		if err != nil {
+			return fmt.Errorf("invalid policy rule %s: %v", r, err)
+		}
+		r.re = re
+	default:
+		return fmt.Errorf("unknown policy rule type: %s", r.Type)
+	}
+	return nil
+}
+
+// String returns the rule as type:value
+func (r PolicyRule) String() string {
+	return r.Type + ":" + r.Value
+}
+
+// match reports whether the rule matches the target URL with the host
+func (r *PolicyRule) match(target, host string) bool {
+	switch r.Type {
+	case ruleDomain:
+		return host == r.Value
+	case ruleSuffix:
+		return host == r.Value || strings.HasSuffix(host, "."+r.Value)
+	case ruleRegex:
+		return r.re.MatchString(target)
+	}
+	return false
+}
+
+// Check returns a PolicyError if a block rule matches the target URL, or no
+// allow rule does in the allowlist-only mode. Allow rules are not exceptions
+// to block rules.
+func (p *Policy) Check(target string) error {
+	parsedURL, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid URL format: %v", err)
+	}
+	host := toASCIIHost(strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), "."))
+	for i := range p.Block {
+		if p.Block[i].match(target, host) {
+			return &PolicyError{Rule: p.Block[i].String()}
+		}
+	}
+	if !p.AllowlistOnly {
+		return nil
+	}
+	for i := range p.Allow {
+		if p.Allow[i].match(target, host) {
+			return nil
+		}
+	}
+	return &PolicyError{Rule: "allowlist"}
+}
+
+// checkPolicy checks the target URL against the current policy
+func checkPolicy(target string) error {
+	policy.mu.RLock()
+	p := policy.p
+	policy.mu.RUnlock()
+	if p == nil {
+		return nil
+	}
+	if err := p.Check(target); err != nil {
+		log.Infof("URL rejected: url=%s; %v", target, err)
+		return err
+	}
+	return nil
+}
+
+// policyStatus returns the status code of a policy check error
+func policyStatus(err error) int {
+	var policyErr *PolicyError
+	if errors.As(err, &policyErr) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusBadRequest
+}
+
+// ReloadPolicyHandler Handle requests reloading the policy file
+func ReloadPolicyHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("POST /api/policy/reload")
+	if config.Config.PolicyFile == "" {
+		http.Error(res, "Policy is disabled", http.StatusNotFound)
+		return
+	}
+	p, err := LoadPolicy(config.Config.PolicyFile)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	responseBytes, err := json.Marshal(p)
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseBytes)
+}
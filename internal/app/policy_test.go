@@ -0,0 +1,164 @@
+package app
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPolicyCheck tests the Policy.Check function
+func TestPolicyCheck(t *testing.T) {
+	p := Policy{
+		Block: []PolicyRule{
+			{Type: "domain", Value: "Evil.com"},
+			{Type: "suffix", Value: ".tk"},
+			{Type: "regex", Value: `/login\.php$`},
+			{Type: "domain", Value: "bücher.example"},
+		},
+	}
+	require.NoError(t, p.Compile())
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{url: "https://evil.com/", rule: "domain:evil.com"},
+		{url: "https://EVIL.com./path", rule: "domain:evil.com"},
+		{url: "https://www.evil.com/"},
+		{url: "https://phish.tk/", rule: "suffix:tk"},
+		{url: "https://tk/", rule: "suffix:tk"},
+		{url: "https://notk.com/"},
+		{url: "https://bank.example.com/login.php", rule: `regex:/login\.php$`},
+		{url: "https://xn--bcher-kva.example/", rule: "domain:xn--bcher-kva.example"},
+		{url: "https://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := p.Check(tt.url)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var policyErr *PolicyError
+			require.ErrorAs(t, err, &policyErr)
+			assert.Equal(t, tt.rule, policyErr.Rule)
+		})
+	}
+
+	// in the allowlist-only mode block rules still win
+	p = Policy{
+		AllowlistOnly: true,
+		Block:         []PolicyRule{{Type: "domain", Value: "bad.example.com"}},
+		Allow:         []PolicyRule{{Type: "suffix", Value: "example.com"}},
+	}
+	require.NoError(t, p.Compile())
+	assert.NoError(t, p.Check("https://www.example.com/"))
+	assert.EqualError(t, p.Check("https://bad.example.com/"), "target URL rejected by policy rule domain:bad.example.com")
+	assert.EqualError(t, p.Check("https://example.org/"), "target URL rejected by policy rule allowlist")
+
+	for _, rule := range []PolicyRule{{Type: "domain"}, {Type: "host", Value: "a"}, {Type: "regex", Value: "("}} {
+		assert.Error(t, (&Policy{Block: []PolicyRule{rule}}).Compile())
+	}
+}
+
+// TestPolicyHandlers tests that rejected targets are not shortened and the policy reloads
+func TestPolicyHandlers(t *testing.T) {
+	setupListStore(t)
+	config.Config.AdminToken = "secret"
+	file, err := os.CreateTemp("", "policy_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	config.Config.PolicyFile = file.Name()
+	defer func() {
+		config.Config.AdminToken = ""
+		config.Config.PolicyFile = ""
+		SetPolicy(nil)
+	}()
+	require.NoError(t, os.WriteFile(file.Name(), []byte(`{"block": [{"type": "domain", "value": "phish.example"}]}`), 0666))
+	_, err = LoadPolicy(file.Name())
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	post := func(path, body string) *http.Response {
+		resp, err := ts.Client().Post(ts.URL+path, "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		return resp
+	}
+	reload := func() int {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/policy/reload", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	resp := post("/", "https://phish.example/login")
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	assert.Contains(t, string(body), "domain:phish.example")
+	resp = post("/api/shorten", `{"url": "https://phish.example/"}`)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	_, ok, err := store.GetURL(getHash("https://phish.example/"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	resp = post("/", "https://fine.example/")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// a reload replaces the rules, an invalid file keeps the current ones
+	require.NoError(t, os.WriteFile(file.Name(), []byte(`{"allowlist_only": true, "allow": [{"type": "suffix", "value": "phish.example"}]}`), 0666))
+	assert.Equal(t, http.StatusOK, reload())
+	resp = post("/", "https://phish.example/")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp = post("/", "https://fine.example/other")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+
+	require.NoError(t, os.WriteFile(file.Name(), []byte(`{"block": [{"type": "regex", "value": "("}]}`), 0666))
+	assert.Equal(t, http.StatusInternalServerError, reload())
+	resp = post("/", "https://fine.example/other")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+}
+
+// TestGetURLHandlerPolicy tests that links to targets blocked later are not followed
+func TestGetURLHandlerPolicy(t *testing.T) {
+	setupListStore(t)
+	defer SetPolicy(nil)
+	require.NoError(t, store.AddURL("bad00001", "https://phish.example/login"))
+	require.NoError(t, store.AddURL("good0001", "https://fine.example/"))
+	p := &Policy{Block: []PolicyRule{{Type: "domain", Value: "phish.example"}}}
+	require.NoError(t, p.Compile())
+	SetPolicy(p)
+
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+	client := ts.Client()
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Get(ts.URL + "/bad00001")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+
+	resp, err = client.Get(ts.URL + "/good0001")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	assert.Equal(t, "https://fine.example/", resp.Header.Get("Location"))
+}
@@ -0,0 +1,130 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// defaultSchemes schemes accepted when none are configured
+var defaultSchemes = []string{"http", "https"}
+
+// forbiddenSchemes schemes running code or embedding content in the browser,
+// rejected even if configured
+var forbiddenSchemes = map[string]bool{
+	"javascript": true,
+	"vbscript":   true,
+	"data":       true,
+	"blob":       true,
+	"file":       true,
+}
+
+// schemeRegexp valid scheme name, RFC 3986
+var schemeRegexp = regexp.MustCompile(`^[a-z][a-z0-9+.\-]*$`)
+
+// telRegexp phone number with optional visual separators and parameters, RFC 3966
+var telRegexp = regexp.MustCompile(`^\+?[0-9().\-]*[0-9][0-9().\-]*(;[a-z0-9\-]+(=[^;]*)?)*$`)
+
+// allowedSchemes returns the configured target URL schemes
+func allowedSchemes() []string {
+	if config.Config.AllowedSchemes == "" {
+		return defaultSchemes
+	}
+	schemes := make([]string, 0)
+	for _, scheme := range strings.Split(config.Config.AllowedSchemes, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// ValidateSchemes checks the comma-separated list of accepted target URL schemes
+func ValidateSchemes(value string) error {
+	for _, scheme := range strings.Split(value, ",") {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if forbiddenSchemes[scheme] {
+			return fmt.Errorf("URL scheme cannot be allowed: %s", scheme)
+		}
+		if scheme != "" && !schemeRegexp.MatchString(scheme) {
+			return fmt.Errorf("invalid URL scheme: %s", scheme)
+		}
+	}
+	return nil
+}
+
+// schemePrefix returns how URLs of the scheme start
+func schemePrefix(scheme string) string {
+	switch scheme {
+	case "mailto", "tel":
+		return scheme + ":"
+	}
+	return scheme + "://"
+}
+
+// validateScheme checks that the scheme is accepted and the URL is valid for it
+func validateScheme(parsedURL *url.URL) error {
+	scheme := parsedURL.Scheme
+	if forbiddenSchemes[scheme] {
+		return fmt.Errorf("URL scheme is not allowed: %s", scheme)
+	}
+	schemes := allowedSchemes()
+	allowed := false
+	prefixes := make([]string, len(schemes))
+	for i, s := range schemes {
+		allowed = allowed || s == scheme
+		prefixes[i] = schemePrefix(s)
+	}
+	if !allowed || scheme == "" {
+		if len(prefixes) == 1 {
+			return fmt.Errorf("URL must start with %s", prefixes[0])
+		}
+		return fmt.Errorf("URL must start with %s or %s",
+			strings.Join(prefixes[:len(prefixes)-1], ", "), prefixes[len(prefixes)-1])
+	}
+	switch scheme {
+	case "http", "https":
+		if parsedURL.Host == "" {
+			return errors.New("URL must contain a host")
+		}
+	case "mailto":
+		return validateMailto(parsedURL)
+	case "tel":
+		return validateTel(parsedURL)
+	default:
+		// app deep links only need something after the scheme
+		if parsedURL.Host == "" && parsedURL.Path == "" && parsedURL.Opaque == "" {
+			return fmt.Errorf("URL must contain a target after %s", schemePrefix(scheme))
+		}
+	}
+	return nil
+}
+
+// validateMailto checks that a mailto URL has valid recipient addresses, RFC 6068
+func validateMailto(parsedURL *url.URL) error {
+	if parsedURL.Opaque == "" {
+		return errors.New("mailto URL must contain an address")
+	}
+	to, err := url.PathUnescape(parsedURL.Opaque)
+	if err != nil {
+		return fmt.Errorf("invalid mailto URL: %v", err)
+	}
+	for _, address := range strings.Split(to, ",") {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("invalid mailto address %q: %v", address, err)
+		}
+	}
+	return nil
+}
+
+// validateTel checks that a tel URL has a phone number, RFC 3966
+func validateTel(parsedURL *url.URL) error {
+	if !telRegexp.MatchString(strings.ToLower(parsedURL.Opaque)) {
+		return fmt.Errorf("invalid phone number: %s", parsedURL.Opaque)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestValidateURLSchemes tests ValidateURL with configured schemes
+func TestValidateURLSchemes(t *testing.T) {
+	setup()
+	tests := []struct {
+		url string
+		err string
+	}{
+		{url: "https://example.com"},
+		{url: "mailto:user@example.com"},
+		{url: "MAILTO:a@example.com,b@example.com?subject=Hi"},
+		{url: "mailto:John%20Doe%20%3Cjohn@example.com%3E"},
+		{url: "tel:+1-201-555-0123"},
+		{url: "tel:555.0123;ext=42"},
+		{url: "myapp://open/item?id=1"},
+		{url: "myapp:item"},
+		{url: "https:///path", err: "URL must contain a host"},
+		{url: "mailto:?subject=Hi", err: "mailto URL must contain an address"},
+		{url: "mailto:not-an-address", err: `invalid mailto address "not-an-address": mail: missing '@' or angle-addr`},
+		{url: "tel:call-me", err: "invalid phone number: call-me"},
+		{url: "myapp://", err: "URL must contain a target after myapp://"},
+		{url: "ftp://example.com/file", err: "URL must start with http://, https://, mailto:, tel: or myapp://"},
+		{url: "example.com", err: "URL must start with http://, https://, mailto:, tel: or myapp://"},
+		{url: "javascript:alert(1)", err: "URL scheme is not allowed: javascript"},
+		{url: "JavaScript:alert(1)", err: "URL scheme is not allowed: javascript"},
+		{url: "data:text/html,<script>alert(1)</script>", err: "URL scheme is not allowed: data"},
+	}
+
+	config.Config.AllowedSchemes = "http, https, mailto, tel, MyApp"
+	defer func() { config.Config.AllowedSchemes = "" }()
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidateURL(tt.url)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+
+	// forbidden schemes are rejected even if configured
+	config.Config.AllowedSchemes = "https,javascript"
+	assert.EqualError(t, ValidateURL("javascript:alert(1)"), "URL scheme is not allowed: javascript")
+	config.Config.AllowedSchemes = ""
+	assert.EqualError(t, ValidateURL("mailto:user@example.com"), "URL must start with http:// or https://")
+}
+
+// TestValidateSchemes tests the ValidateSchemes function
+func TestValidateSchemes(t *testing.T) {
+	assert.NoError(t, ValidateSchemes("http,https, mailto,tel,my-app+v2"))
+	assert.EqualError(t, ValidateSchemes("https,Data"), "URL scheme cannot be allowed: data")
+	assert.EqualError(t, ValidateSchemes("https,2app"), "invalid URL scheme: 2app")
+}
+
+// TestPostURLHandlerMailto tests shortening and redirecting to a mailto URL
+func TestPostURLHandlerMailto(t *testing.T) {
+	setupListStore(t)
+	config.Config.AllowedSchemes = "http,https,mailto"
+	defer func() { config.Config.AllowedSchemes = "" }()
+
+	target := "mailto:support@example.com?subject=Help"
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(target))
+	res := httptest.NewRecorder()
+	PostURLHandler(res, req)
+	require.Equal(t, http.StatusCreated, res.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/"+getHash(target), nil)
+	res = httptest.NewRecorder()
+	GetURLHandler(res, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.Code)
+	assert.Equal(t, target, res.Header().Get("Location"))
+}
@@ -0,0 +1,115 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxSelfHops number of links to this shortener followed to the final target
+const maxSelfHops = 10
+
+// ErrSelfLink is returned for a target on this shortener that is not a live short link
+var ErrSelfLink = errors.New("target URL points to this shortener")
+
+// ErrRedirectLoop is returned when links to this shortener lead back to a visited link
+var ErrRedirectLoop = errors.New("redirect loop")
+
+// ownBase parsed base URL serving the short links
+type ownBase struct {
+	host string
+	path string
+}
+
+// ownBases returns the base URL and the additional base URLs serving the short links
+func ownBases() []ownBase {
+	values := []string{config.Config.BaseURL}
+	if config.Config.SelfURLs != "" {
+		values = append(values, strings.Split(config.Config.SelfURLs, ",")...)
+	}
+	bases := make([]ownBase, 0, len(values))
+	for _, value := range values {
+		parsedURL, err := url.Parse(strings.TrimSpace(value))
+		if err != nil || parsedURL.Host == "" {
+			continue
+		}
+		bases = append(bases, ownBase{
+			host: hostKey(parsedURL),
+			path: strings.TrimSuffix(parsedURL.Path, "/") + "/",
+		})
+	}
+	return bases
+}
+
+// hostKey returns the lowercased host of the URL without its default port,
+// http and https are not told apart
+func hostKey(parsedURL *url.URL) string {
+	host := toASCIIHost(strings.TrimSuffix(strings.ToLower(parsedURL.Hostname()), "."))
+	if port := parsedURL.Port(); port != "" && port != defaultPorts[strings.ToLower(parsedURL.Scheme)] {
+		return host + ":" + port
+	}
+	return host
+}
+
+// ownPath returns the path of the URL below a base URL of this shortener
+func ownPath(parsedURL *url.URL) (string, bool) {
+	host := hostKey(parsedURL)
+	for _, base := range ownBases() {
+		if host == base.host && strings.HasPrefix(parsedURL.Path+"/", base.path) {
+			return strings.TrimPrefix(parsedURL.Path, base.path), true
+		}
+	}
+	return "", false
+}
+
+// resolveSelfURL follows the links to this shortener in the target URL to the
+// final target. Short IDs in visited are treated as already followed.
+func resolveSelfURL(target string, visited ...string) (string, error) {
+	seen := make(map[string]bool)
+	for _, id := range visited {
+		seen[id] = true
+	}
+	for hops := 0; ; hops++ {
+		parsedURL, err := url.Parse(target)
+		if err != nil {
+			return "", err
+		}
+		path, ok := ownPath(parsedURL)
+		if !ok {
+			return target, nil
+		}
+		id, suffix, _ := strings.Cut(path, "/")
+		if seen[id] || hops >= maxSelfHops {
+			return "", fmt.Errorf("%w: %s", ErrRedirectLoop, target)
+		}
+		seen[id] = true
+		row, ok, err := store.GetRow(id)
+		if err != nil {
+			return "", err
+		}
+		if id == "" || !ok || row.Expired(time.Now()) {
+			return "", fmt.Errorf("%w: %s", ErrSelfLink, target)
+		}
+		if row.Passthrough {
+			if target, err = passthroughURL(row.OriginalURL, suffix, parsedURL.Query()); err != nil {
+				return "", err
+			}
+		} else if suffix != "" || parsedURL.RawQuery != "" {
+			return "", fmt.Errorf("%w: %s", ErrSelfLink, target)
+		} else {
+			target = row.OriginalURL
+		}
+	}
+}
+
+// selfLinkStatus returns the status code of a resolveSelfURL error
+func selfLinkStatus(err error) int {
+	if errors.Is(err, ErrSelfLink) || errors.Is(err, ErrRedirectLoop) || errors.Is(err, errDotSegment) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
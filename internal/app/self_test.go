@@ -0,0 +1,95 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResolveSelfURL tests the resolveSelfURL function
+func TestResolveSelfURL(t *testing.T) {
+	setupListStore(t)
+	config.Config.SelfURLs = "https://sho.rt, http://old.example.com/s"
+	defer func() { config.Config.SelfURLs = "" }()
+	store.AddURL("target", "https://example.com/final")
+	store.AddURL("chain", "https://sho.rt/target")
+	store.AddRow(storage.DataRow{ShortURL: "pass", OriginalURL: "https://example.com/docs?lang=en", Passthrough: true})
+	store.AddURL("loop1", "http://localhost:8080/loop2")
+	store.AddURL("loop2", "HTTP://LOCALHOST:8080/loop1")
+
+	tests := []struct {
+		name   string
+		target string
+		want   string
+		err    error
+	}{
+		{name: "Other host", target: "https://example.com/target", want: "https://example.com/target"},
+		{name: "Base URL", target: "http://localhost:8080/target", want: "https://example.com/final"},
+		{name: "Other base URL", target: "https://sho.rt:443/target", want: "https://example.com/final"},
+		{name: "Base URL path", target: "http://old.example.com/s/chain", want: "https://example.com/final"},
+		{name: "Outside base URL path", target: "http://old.example.com/target", want: "http://old.example.com/target"},
+		{name: "Passthrough", target: "https://sho.rt/pass/api?v=1", want: "https://example.com/docs/api?lang=en&v=1"},
+		{name: "Passthrough dot segments", target: "https://sho.rt/pass/../admin", err: errDotSegment},
+		{name: "Suffix", target: "https://sho.rt/target/extra", err: ErrSelfLink},
+		{name: "Unknown", target: "https://sho.rt/unknown", err: ErrSelfLink},
+		{name: "Not a short link", target: "http://localhost:8080/api/urls", err: ErrSelfLink},
+		{name: "Root", target: "http://localhost:8080", err: ErrSelfLink},
+		{name: "Loop", target: "https://sho.rt/loop1", err: ErrRedirectLoop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSelfURL(tt.target)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := resolveSelfURL("https://sho.rt/target", "target")
+	assert.ErrorIs(t, err, ErrRedirectLoop)
+}
+
+// TestSelfLinkHandlers tests that links to this shortener are resolved or rejected
+func TestSelfLinkHandlers(t *testing.T) {
+	setupListStore(t)
+	store.AddURL("target", "https://example.com/final")
+	store.AddURL("self", "http://localhost:8080/self")
+	store.AddURL("hop", "http://localhost:8080/target")
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		res := httptest.NewRecorder()
+		PostURLHandler(res, req)
+		return res
+	}
+	res := post("http://localhost:8080/target")
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, config.Config.BaseURL+"/"+getHash("https://example.com/final"), res.Body.String())
+	assert.Equal(t, http.StatusUnprocessableEntity, post("http://localhost:8080/missing").Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "http://localhost:8080/self"}`))
+	res = httptest.NewRecorder()
+	PostURLHandlerJSON(res, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+
+	// links stored before they were resolved
+	for id, code := range map[string]int{"self": http.StatusLoopDetected, "hop": http.StatusTemporaryRedirect} {
+		req := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+		res := httptest.NewRecorder()
+		GetURLHandler(res, req)
+		assert.Equal(t, code, res.Code, id)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/hop", nil)
+	res = httptest.NewRecorder()
+	GetURLHandler(res, req)
+	assert.Equal(t, "https://example.com/final", res.Header().Get("Location"))
+}
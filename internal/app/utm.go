@@ -0,0 +1,175 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+)
+
+// UTMTemplate named set of UTM parameters appended to shortened URLs
+type UTMTemplate struct {
+	Name     string `json:"name"`
+	Source   string `json:"source"`
+	Medium   string `json:"medium"`
+	Campaign string `json:"campaign"`
+}
+
+// utmTemplates registry of UTM templates by name, configured holds the names
+// loaded from the templates file
+var utmTemplates = struct {
+	mu         sync.RWMutex
+	m          map[string]UTMTemplate
+	configured map[string]bool
+}{m: make(map[string]UTMTemplate), configured: make(map[string]bool)}
+
+// ErrUTMTemplateConfigured is returned when the API would replace a template loaded from the file
+var ErrUTMTemplateConfigured = errors.New("UTM template is defined in the templates file")
+
+// LoadUTMTemplates loads UTM templates from a JSON file with an array of templates
+func LoadUTMTemplates(filename string) error {
+	log.Infof("Loading UTM templates: %s", filename)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var templates []UTMTemplate
+	if err := json.Unmarshal(data, &templates); err != nil {
+		return err
+	}
+	for _, template := range templates {
+		if err := template.Validate(); err != nil {
+			return err
+		}
+	}
+	utmTemplates.mu.Lock()
+	defer utmTemplates.mu.Unlock()
+	for _, template := range templates {
+		utmTemplates.m[template.Name] = template
+		utmTemplates.configured[template.Name] = true
+	}
+	return nil
+}
+
+// SetUTMTemplate adds or replaces a UTM template defined through the API,
+// templates loaded from the file cannot be replaced. API templates are kept
+// in memory only, the templates file is the place for permanent ones.
+func SetUTMTemplate(template UTMTemplate) error {
+	if err := template.Validate(); err != nil {
+		return err
+	}
+	utmTemplates.mu.Lock()
+	defer utmTemplates.mu.Unlock()
+	if utmTemplates.configured[template.Name] {
+		return fmt.Errorf("%w: %s", ErrUTMTemplateConfigured, template.Name)
+	}
+	utmTemplates.m[template.Name] = template
+	return nil
+}
+
+// GetUTMTemplate retrieves a UTM template by its name
+func GetUTMTemplate(name string) (UTMTemplate, bool) {
+	utmTemplates.mu.RLock()
+	defer utmTemplates.mu.RUnlock()
+	template, ok := utmTemplates.m[name]
+	return template, ok
+}
+
+// Validate checks if the required fields are present
+func (t *UTMTemplate) Validate() error {
+	if t.Name == "" {
+		return errors.New("UTM template name cannot be empty")
+	}
+	if t.Source == "" {
+		return errors.New("UTM template source cannot be empty")
+	}
+	return nil
+}
+
+// Apply rewrites the URL with the template parameters, replacing existing ones
+func (t *UTMTemplate) Apply(value string) (string, error) {
+	parsedURL, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL format: %v", err)
+	}
+	query := parsedURL.Query()
+	query.Set("utm_source", t.Source)
+	if t.Medium != "" {
+		query.Set("utm_medium", t.Medium)
+	}
+	if t.Campaign != "" {
+		query.Set("utm_campaign", t.Campaign)
+	}
+	parsedURL.RawQuery = query.Encode()
+	return parsedURL.String(), nil
+}
+
+// applyUTMTemplate rewrites the URL with the named template
+func applyUTMTemplate(name, value string) (string, error) {
+	template, ok := GetUTMTemplate(name)
+	if !ok {
+		return "", fmt.Errorf("UTM template not found: %s", name)
+	}
+	return template.Apply(value)
+}
+
+// ListUTMTemplatesHandler Handle UTM templates list requests
+func ListUTMTemplatesHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("GET /api/utm")
+	utmTemplates.mu.RLock()
+	templates := make([]UTMTemplate, 0, len(utmTemplates.m))
+	for _, template := range utmTemplates.m {
+		templates = append(templates, template)
+	}
+	utmTemplates.mu.RUnlock()
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	responseBytes, err := json.Marshal(templates)
+	if err != nil {
+		http.Error(res, "Unable to marshal response", http.StatusInternalServerError)
+		return
+	}
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusOK)
+	res.Write(responseBytes)
+}
+
+// PostUTMTemplateHandler Handle POST requests defining a UTM template
+func PostUTMTemplateHandler(res http.ResponseWriter, req *http.Request) {
+	log.Infof("POST /api/utm")
+	if req.Body == nil {
+		http.Error(res, "Empty body", http.StatusBadRequest)
+		return
+	}
+	bodyBytes, err := io.ReadAll(req.Body)
+	if err != nil {
+		http.Error(res, "Unable to read body", http.StatusBadRequest)
+		return
+	}
+	if len(bodyBytes) == 0 {
+		http.Error(res, "Empty body", http.StatusBadRequest)
+		return
+	}
+	var template UTMTemplate
+	if err := json.Unmarshal(bodyBytes, &template); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := SetUTMTemplate(template); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrUTMTemplateConfigured) {
+			status = http.StatusConflict
+		}
+		http.Error(res, err.Error(), status)
+		return
+	}
+	log.Infof("UTM template saved: %s", template.Name)
+	res.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,117 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUTMTemplateApply tests the UTMTemplate.Apply function
+func TestUTMTemplateApply(t *testing.T) {
+	template := UTMTemplate{Name: "mail", Source: "newsletter", Medium: "email", Campaign: "spring"}
+
+	result, err := template.Apply("https://example.com/page?id=1&utm_source=old")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/page?id=1&utm_campaign=spring&utm_medium=email&utm_source=newsletter", result)
+}
+
+// TestLoadUTMTemplates tests the LoadUTMTemplates function
+func TestLoadUTMTemplates(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "utm_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.WriteString(`[{"name": "promo", "source": "ads", "medium": "cpc"}]`)
+	file.Close()
+
+	require.NoError(t, LoadUTMTemplates(file.Name()))
+	template, ok := GetUTMTemplate("promo")
+	assert.True(t, ok)
+	assert.Equal(t, "cpc", template.Medium)
+
+	// templates from the file cannot be replaced through the API
+	err = SetUTMTemplate(UTMTemplate{Name: "promo", Source: "spam"})
+	assert.ErrorIs(t, err, ErrUTMTemplateConfigured)
+	template, _ = GetUTMTemplate("promo")
+	assert.Equal(t, "ads", template.Source)
+}
+
+// TestPostURLHandlerJSONWithUTM tests shortening with a UTM template
+func TestPostURLHandlerJSONWithUTM(t *testing.T) {
+	setup()
+	require.NoError(t, SetUTMTemplate(UTMTemplate{Name: "social", Source: "twitter", Medium: "social"}))
+
+	tests := []struct {
+		name string
+		body string
+		code int
+		url  string
+	}{
+		{
+			name: "Known template",
+			body: `{"url": "https://example.com/utm", "utm": "social"}`,
+			code: http.StatusCreated,
+			url:  "https://example.com/utm?utm_medium=social&utm_source=twitter",
+		},
+		{
+			name: "Unknown template",
+			body: `{"url": "https://example.com/utm", "utm": "unknown"}`,
+			code: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(tt.body))
+			res := httptest.NewRecorder()
+
+			PostURLHandlerJSON(res, req)
+
+			result := res.Result()
+			defer result.Body.Close()
+			assert.Equal(t, tt.code, result.StatusCode)
+			if tt.code != http.StatusCreated {
+				return
+			}
+			url, ok, err := store.GetURL(getHash(tt.url))
+			require.NoError(t, err)
+			assert.True(t, ok)
+			assert.Equal(t, tt.url, url)
+		})
+	}
+}
+
+// TestUTMTemplateHandlers tests defining and listing UTM templates
+func TestUTMTemplateHandlers(t *testing.T) {
+	setup()
+	ts := httptest.NewServer(Router())
+	defer ts.Close()
+
+	// defining templates is an admin route
+	resp, _ := testRequest(t, ts, http.MethodPost, "/api/utm", `{"name": "api", "source": "partner"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	config.Config.AdminToken = "secret"
+	defer func() { config.Config.AdminToken = "" }()
+	resp, _ = testRequest(t, ts, http.MethodPost, "/api/utm", `{"name": "api", "source": "partner"}`)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, _ = testAdminRequest(t, ts, http.MethodPost, "/api/utm", `{"name": "api", "source": "partner"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, _ = testAdminRequest(t, ts, http.MethodPost, "/api/utm", `{"name": "api"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, body := testRequest(t, ts, http.MethodGet, "/api/utm", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var templates []UTMTemplate
+	require.NoError(t, json.Unmarshal([]byte(body), &templates))
+	assert.Contains(t, templates, UTMTemplate{Name: "api", Source: "partner"})
+}
@@ -1,10 +1,32 @@
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
 // AppConfig struct
 type AppConfig struct {
-	ServerAddress   string
-	BaseURL         string
-	FileStoragePath string
+	ServerAddress    string
+	BaseURL          string
+	FileStoragePath  string
+	RedirectCode     int
+	UTMTemplates     string
+	AdminToken       string
+	StorageDSN       string
+	FileSync         string
+	FileSyncInterval time.Duration
+	FileChecksums    bool
+	FollowInterval   time.Duration
+	PrimaryURL       string
+	CacheSize        int
+	CacheNegativeTTL time.Duration
+	BloomFPRate      float64
+	EncryptionKeys   string
+	NormalizeURLs    bool
+	PolicyFile       string
+	SelfURLs         string
+	AllowedSchemes   string
 }
 
 // Config variable
@@ -19,6 +41,30 @@ func ParseConfig() {
 	Config.ServerAddress = chooseNonEmpty(env.ServerAddress, flagRunAddr)
 	Config.BaseURL = chooseNonEmpty(env.BaseURL, flagBaseURL)
 	Config.FileStoragePath = chooseNonEmpty(env.FileStoragePath, flagFileStoragePath)
+	Config.RedirectCode = chooseNonZero(env.RedirectCode, flagRedirectCode)
+	Config.UTMTemplates = chooseNonEmpty(env.UTMTemplates, flagUTMTemplates)
+	Config.AdminToken = chooseNonEmpty(env.AdminToken, flagAdminToken)
+	Config.FileSync = chooseNonEmpty(env.FileSync, flagFileSync)
+	Config.FileSyncInterval = chooseNonZero(env.FileSyncInterval, flagFileSyncInterval)
+	// the file storage path and sync policy are used unless a storage DSN is given
+	Config.FileChecksums = chooseNonZero(env.FileChecksums, flagFileChecksums)
+	fileDSN := fmt.Sprintf("file:%s?sync=%s&sync_interval=%s&crc=%t",
+		Config.FileStoragePath, Config.FileSync, Config.FileSyncInterval, Config.FileChecksums)
+	// a follower tails the file of the primary instead of writing it
+	Config.FollowInterval = chooseNonZero(env.FollowInterval, flagFollowInterval)
+	Config.PrimaryURL = chooseNonEmpty(env.PrimaryURL, flagPrimaryURL)
+	if Config.FollowInterval > 0 {
+		fileDSN = fmt.Sprintf("file:%s?follow=%s", Config.FileStoragePath, Config.FollowInterval)
+	}
+	Config.CacheSize = chooseNonZero(env.CacheSize, flagCacheSize)
+	Config.CacheNegativeTTL = chooseNonZero(env.CacheNegativeTTL, flagCacheNegativeTTL)
+	Config.BloomFPRate = chooseNonZero(env.BloomFPRate, flagBloomFPRate)
+	Config.EncryptionKeys = chooseNonEmpty(env.EncryptionKeys, flagEncryptionKeys)
+	Config.NormalizeURLs = chooseNonZero(env.NormalizeURLs, flagNormalizeURLs)
+	Config.PolicyFile = chooseNonEmpty(env.PolicyFile, flagPolicyFile)
+	Config.SelfURLs = chooseNonEmpty(env.SelfURLs, flagSelfURLs)
+	Config.AllowedSchemes = chooseNonEmpty(env.AllowedSchemes, flagAllowedSchemes)
+	Config.StorageDSN = chooseNonEmpty(chooseNonEmpty(env.StorageDSN, flagStorageDSN), fileDSN)
 }
 
 // chooseNonEmpty returns the first non-empty string from the arguments
@@ -28,3 +74,12 @@ func chooseNonEmpty(primary, fallback string) string {
 	}
 	return fallback
 }
+
+// chooseNonZero returns the first non-zero value from the arguments
+func chooseNonZero[T comparable](primary, fallback T) T {
+	var zero T
+	if primary != zero {
+		return primary
+	}
+	return fallback
+}
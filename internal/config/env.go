@@ -1,14 +1,46 @@
 package config
 
 import (
+	"fmt"
 	"github.com/caarlos0/env/v6"
 	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"time"
 )
 
 type EnvConfig struct {
-	ServerAddress   string `env:"SERVER_ADDRESS"`
-	BaseURL         string `env:"BASE_URL"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
+	ServerAddress    string        `env:"SERVER_ADDRESS"`
+	BaseURL          string        `env:"BASE_URL"`
+	FileStoragePath  string        `env:"FILE_STORAGE_PATH"`
+	RedirectCode     int           `env:"REDIRECT_CODE"`
+	UTMTemplates     string        `env:"UTM_TEMPLATES"`
+	AdminToken       string        `env:"ADMIN_TOKEN"`
+	StorageDSN       string        `env:"STORAGE_DSN"`
+	FileSync         string        `env:"FILE_SYNC"`
+	FileSyncInterval time.Duration `env:"FILE_SYNC_INTERVAL"`
+	FileChecksums    bool          `env:"FILE_CHECKSUMS"`
+	FollowInterval   time.Duration `env:"FOLLOW_INTERVAL"`
+	PrimaryURL       string        `env:"PRIMARY_URL"`
+	CacheSize        int           `env:"CACHE_SIZE"`
+	CacheNegativeTTL time.Duration `env:"CACHE_NEGATIVE_TTL"`
+	BloomFPRate      float64       `env:"BLOOM_FP_RATE"`
+	EncryptionKeys   string        `env:"ENCRYPTION_KEYS"`
+	NormalizeURLs    bool          `env:"NORMALIZE_URLS"`
+	PolicyFile       string        `env:"POLICY_FILE"`
+	SelfURLs         string        `env:"SELF_URLS"`
+	AllowedSchemes   string        `env:"ALLOWED_SCHEMES"`
+}
+
+// String formats the environment variables with secrets masked
+func (cfg EnvConfig) String() string {
+	type plain EnvConfig
+	masked := plain(cfg)
+	if masked.AdminToken != "" {
+		masked.AdminToken = "***"
+	}
+	if masked.EncryptionKeys != "" {
+		masked.EncryptionKeys = "***"
+	}
+	return fmt.Sprintf("%+v", masked)
 }
 
 // GetEnvConfig parses and returns environment variables
@@ -2,6 +2,7 @@ package config
 
 import (
 	"flag"
+	"time"
 )
 
 // FlagRunAddr address and port to run server
@@ -13,10 +14,78 @@ var flagBaseURL string
 // flagFileStoragePath path to file storage
 var flagFileStoragePath string
 
+// flagRedirectCode default redirect status code
+var flagRedirectCode int
+
+// flagUTMTemplates path to UTM templates file
+var flagUTMTemplates string
+
+// flagAdminToken bearer token for admin routes
+var flagAdminToken string
+
+// flagStorageDSN storage backend DSN
+var flagStorageDSN string
+
+// flagFileSync fsync policy of the file storage
+var flagFileSync string
+
+// flagFileSyncInterval period of the interval fsync policy
+var flagFileSyncInterval time.Duration
+
+// flagFileChecksums adds a CRC to every file storage line
+var flagFileChecksums bool
+
+// flagFollowInterval poll period of a read-only follower, 0 runs a primary
+var flagFollowInterval time.Duration
+
+// flagPrimaryURL primary the follower forwards writes to
+var flagPrimaryURL string
+
+// flagCacheSize number of records kept by the lookup cache, 0 disables it
+var flagCacheSize int
+
+// flagCacheNegativeTTL how long a missing short URL is cached
+var flagCacheNegativeTTL time.Duration
+
+// flagBloomFPRate false-positive rate of the short URL bloom filter, 0 disables it
+var flagBloomFPRate float64
+
+// flagEncryptionKeys AES-GCM keys of the stored target URLs
+var flagEncryptionKeys string
+
+// flagNormalizeURLs normalizes target URLs before hashing
+var flagNormalizeURLs bool
+
+// flagPolicyFile path to the JSON policy of the allowed target URLs
+var flagPolicyFile string
+
+// flagSelfURLs other base URLs serving the short links
+var flagSelfURLs string
+
+// flagAllowedSchemes accepted target URL schemes
+var flagAllowedSchemes string
+
 // ParseFlags parses flags
 func parseFlags() {
 	flag.StringVar(&flagRunAddr, "a", "localhost:8080", "address and port to run server")
 	flag.StringVar(&flagBaseURL, "b", "http://localhost:8080", "base URL for result")
 	flag.StringVar(&flagFileStoragePath, "f", "/tmp/storage.txt", "path to file storage")
+	flag.IntVar(&flagRedirectCode, "r", 307, "default redirect status code (301, 302, 303, 307 or 308)")
+	flag.StringVar(&flagUTMTemplates, "u", "", "path to UTM templates JSON file")
+	flag.StringVar(&flagAdminToken, "t", "", "bearer token for admin routes, admin routes are disabled if empty")
+	flag.StringVar(&flagStorageDSN, "s", "", "storage DSN (file:, memory: or kv: followed by a path), file:<-f path> by default")
+	flag.StringVar(&flagFileSync, "sync", "interval", "file storage fsync policy: always, interval or never")
+	flag.DurationVar(&flagFileSyncInterval, "sync-interval", time.Second, "file storage fsync period of the interval policy")
+	flag.BoolVar(&flagFileChecksums, "crc", false, "add a CRC to every file storage line")
+	flag.DurationVar(&flagFollowInterval, "follow", 0, "run as a read-only follower polling the file storage of the primary with this period")
+	flag.StringVar(&flagPrimaryURL, "primary", "", "URL of the primary the follower forwards writes to, writes are rejected with 503 if empty")
+	flag.IntVar(&flagCacheSize, "cache-size", 0, "number of records kept by the lookup cache, 0 disables the cache")
+	flag.DurationVar(&flagCacheNegativeTTL, "cache-negative-ttl", 5*time.Second, "how long a missing short URL is cached, 0 disables negative entries")
+	flag.Float64Var(&flagBloomFPRate, "bloom-fp-rate", 0, "false-positive rate of the short URL bloom filter, e.g. 0.01, 0 disables the filter")
+	flag.StringVar(&flagEncryptionKeys, "encryption-keys", "", "encrypt stored target URLs with AES-GCM keys id:base64key[,id:base64key...], the first one is active; prefer ENCRYPTION_KEYS")
+	flag.BoolVar(&flagNormalizeURLs, "normalize-urls", false, "normalize target URLs before hashing, so equivalent URLs get the same short link")
+	flag.StringVar(&flagPolicyFile, "policy", "", "path to the JSON file with the block and allow rules of target URLs")
+	flag.StringVar(&flagSelfURLs, "self-urls", "", "comma-separated other base URLs serving the short links, e.g. old domains, links to them are resolved")
+	flag.StringVar(&flagAllowedSchemes, "schemes", "http,https", "comma-separated accepted target URL schemes, e.g. http,https,mailto,tel,myapp; javascript, vbscript, data, blob and file are always rejected")
 	flag.Parse()
 }
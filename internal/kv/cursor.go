@@ -0,0 +1,132 @@
+package kv
+
+// frame position in a node on the path of a cursor
+type frame struct {
+	n *node
+	i int
+}
+
+// Cursor iterates the keys of a bucket in order
+type Cursor struct {
+	bucket *Bucket
+	stack  []frame
+}
+
+// Cursor returns a cursor over the bucket
+func (b *Bucket) Cursor() *Cursor {
+	return &Cursor{bucket: b}
+}
+
+// First moves to the first key, a nil key means the bucket is empty
+func (c *Cursor) First() ([]byte, []byte, error) {
+	root, err := c.bucket.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.stack = c.stack[:0]
+	if err := c.descend(root, true); err != nil {
+		return nil, nil, err
+	}
+	return c.current()
+}
+
+// Last moves to the last key, a nil key means the bucket is empty
+func (c *Cursor) Last() ([]byte, []byte, error) {
+	root, err := c.bucket.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.stack = c.stack[:0]
+	if err := c.descend(root, false); err != nil {
+		return nil, nil, err
+	}
+	return c.current()
+}
+
+// Seek moves to the first key not less than seek, a nil key means there is none
+func (c *Cursor) Seek(seek []byte) ([]byte, []byte, error) {
+	n, err := c.bucket.root()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.stack = c.stack[:0]
+	for !n.leaf {
+		i := n.childIndex(seek)
+		c.stack = append(c.stack, frame{n: n, i: i})
+		if n, err = c.bucket.tx.child(n, i); err != nil {
+			return nil, nil, err
+		}
+	}
+	i := n.search(seek)
+	if i < len(n.keys) {
+		c.stack = append(c.stack, frame{n: n, i: i})
+		return c.current()
+	}
+	// past the end of the leaf, continue in the next one
+	c.stack = append(c.stack, frame{n: n, i: len(n.keys) - 1})
+	return c.Next()
+}
+
+// Next moves to the next key, a nil key means the end was reached
+func (c *Cursor) Next() ([]byte, []byte, error) {
+	return c.move(1)
+}
+
+// Prev moves to the previous key, a nil key means the start was reached
+func (c *Cursor) Prev() ([]byte, []byte, error) {
+	return c.move(-1)
+}
+
+// move steps the cursor forward or backward across node boundaries
+func (c *Cursor) move(step int) ([]byte, []byte, error) {
+	for depth := len(c.stack) - 1; depth >= 0; depth-- {
+		f := &c.stack[depth]
+		f.i += step
+		if f.i < 0 || f.i >= len(f.n.keys) {
+			continue
+		}
+		c.stack = c.stack[:depth+1]
+		if !f.n.leaf {
+			child, err := c.bucket.tx.child(f.n, f.i)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := c.descend(child, step > 0); err != nil {
+				return nil, nil, err
+			}
+		}
+		return c.current()
+	}
+	c.stack = c.stack[:0]
+	return nil, nil, nil
+}
+
+// descend pushes the path from n to its first or last leaf entry
+func (c *Cursor) descend(n *node, first bool) error {
+	for {
+		i := 0
+		if !first {
+			i = len(n.keys) - 1
+		}
+		c.stack = append(c.stack, frame{n: n, i: i})
+		if n.leaf {
+			return nil
+		}
+		var err error
+		if n, err = c.bucket.tx.child(n, i); err != nil {
+			return err
+		}
+	}
+}
+
+// current returns the key and value under the cursor
+func (c *Cursor) current() ([]byte, []byte, error) {
+	if len(c.stack) == 0 {
+		return nil, nil, nil
+	}
+	f := c.stack[len(c.stack)-1]
+	if f.i < 0 || f.i >= len(f.n.keys) {
+		return nil, nil, nil
+	}
+	return f.n.keys[f.i], f.n.values[f.i], nil
+}
@@ -0,0 +1,378 @@
+// Package kv is a small embedded key-value store keeping ordered buckets in
+// copy-on-write B+trees inside a single file.
+//
+// Every committed write transaction appends the nodes it changed and a catalog
+// of the bucket roots to the end of the file, then records the catalog in one of
+// two meta slots at the start of the file. Nodes are never overwritten, so
+// readers see a consistent snapshot without locking out the writer, and a crash
+// in the middle of a commit leaves the previous meta in place. Space of replaced
+// nodes is reclaimed by Compact.
+package kv
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	// magic identifies the file format
+	magic = "SHKVDB01"
+	// metaSize size of a meta slot
+	metaSize = 32
+	// dataStart offset of the first record after the two meta slots
+	dataStart = int64(len(magic) + 2*metaSize)
+	// recordHeader size of the length and CRC in front of every record
+	recordHeader = 8
+	// maxRecord largest record payload accepted on read
+	maxRecord = 1 << 28
+)
+
+// ErrCorrupted is returned when a record or the file header does not decode
+var ErrCorrupted = errors.New("kv: corrupted file")
+
+// ErrTxNotWritable is returned on writes in a read-only transaction
+var ErrTxNotWritable = errors.New("kv: transaction is read-only")
+
+// meta committed state of the file
+type meta struct {
+	txid    uint64
+	catalog int64
+	end     int64
+}
+
+// Options of a database
+type Options struct {
+	// NoSync skips the fsync of commits, a crash may lose recent transactions
+	NoSync bool
+}
+
+// DB embedded key-value store
+type DB struct {
+	path   string
+	file   *os.File
+	noSync bool
+	// remap excludes transactions while Compact replaces the file
+	remap sync.RWMutex
+	// writer serializes write transactions
+	writer sync.Mutex
+	// mu guards meta, catalog and cache
+	mu      sync.RWMutex
+	meta    meta
+	catalog map[string]int64
+	cache   map[int64]*node
+}
+
+// Open opens or creates the database file. The caller makes sure only one
+// process opens the file at a time.
+func Open(path string, options *Options) (*DB, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	db := &DB{path: path, noSync: options.NoSync}
+	if err := db.open(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// open opens the file and loads the latest committed meta and catalog
+func (db *DB) open() error {
+	file, err := os.OpenFile(db.path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	db.file = file
+	db.cache = make(map[int64]*node)
+	info, err := file.Stat()
+	if err == nil && info.Size() == 0 {
+		err = db.init()
+	} else if err == nil {
+		err = db.load(info.Size())
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("%s: %w", db.path, err)
+	}
+	return nil
+}
+
+// init writes the header and an empty catalog to a new file
+func (db *DB) init() error {
+	if _, err := db.file.WriteAt([]byte(magic), 0); err != nil {
+		return err
+	}
+	record := appendRecord(nil, encodeCatalog(map[string]int64{}))
+	if _, err := db.file.WriteAt(record, dataStart); err != nil {
+		return err
+	}
+	db.catalog = map[string]int64{}
+	return db.writeMeta(meta{txid: 1, catalog: dataStart, end: dataStart + int64(len(record))})
+}
+
+// load reads the newest valid meta, drops a commit torn after its data was
+// written and reads the catalog
+func (db *DB) load(size int64) error {
+	header := make([]byte, dataStart)
+	if _, err := db.file.ReadAt(header, 0); err != nil {
+		return ErrCorrupted
+	}
+	if string(header[:len(magic)]) != magic {
+		return ErrCorrupted
+	}
+	var current meta
+	found := false
+	for slot := 0; slot < 2; slot++ {
+		start := len(magic) + slot*metaSize
+		m, ok := decodeMeta(header[start : start+metaSize])
+		if ok && m.end <= size && (!found || m.txid > current.txid) {
+			current, found = m, true
+		}
+	}
+	if !found {
+		return ErrCorrupted
+	}
+	if size > current.end {
+		if err := db.file.Truncate(current.end); err != nil {
+			return err
+		}
+	}
+	payload, err := db.readRecord(current.catalog)
+	if err != nil {
+		return err
+	}
+	catalog, err := decodeCatalog(payload)
+	if err != nil {
+		return err
+	}
+	db.meta = current
+	db.catalog = catalog
+	return nil
+}
+
+// writeMeta records the committed state in the slot of its transaction
+func (db *DB) writeMeta(m meta) error {
+	buf := make([]byte, metaSize)
+	binary.BigEndian.PutUint64(buf[0:], m.txid)
+	binary.BigEndian.PutUint64(buf[8:], uint64(m.catalog))
+	binary.BigEndian.PutUint64(buf[16:], uint64(m.end))
+	binary.BigEndian.PutUint32(buf[24:], crc32.ChecksumIEEE(buf[:24]))
+	if _, err := db.file.WriteAt(buf, int64(len(magic))+int64(m.txid%2)*metaSize); err != nil {
+		return err
+	}
+	if err := db.sync(); err != nil {
+		return err
+	}
+	db.meta = m
+	return nil
+}
+
+// decodeMeta parses a meta slot, a slot with a wrong CRC is not valid
+func decodeMeta(buf []byte) (meta, bool) {
+	if crc32.ChecksumIEEE(buf[:24]) != binary.BigEndian.Uint32(buf[24:]) {
+		return meta{}, false
+	}
+	m := meta{
+		txid:    binary.BigEndian.Uint64(buf[0:]),
+		catalog: int64(binary.BigEndian.Uint64(buf[8:])),
+		end:     int64(binary.BigEndian.Uint64(buf[16:])),
+	}
+	return m, m.txid > 0 && m.catalog >= dataStart && m.end > m.catalog
+}
+
+// sync flushes the file unless syncing is disabled
+func (db *DB) sync() error {
+	if db.noSync {
+		return nil
+	}
+	return db.file.Sync()
+}
+
+// appendRecord appends the payload with its length and CRC
+func appendRecord(buf, payload []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	return append(buf, payload...)
+}
+
+// readRecord reads and checks the record at the offset
+func (db *DB) readRecord(offset int64) ([]byte, error) {
+	header := make([]byte, recordHeader)
+	if _, err := db.file.ReadAt(header, offset); err != nil {
+		return nil, ErrCorrupted
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > maxRecord {
+		return nil, ErrCorrupted
+	}
+	payload := make([]byte, length)
+	if _, err := db.file.ReadAt(payload, offset+recordHeader); err == io.EOF {
+		return nil, ErrCorrupted
+	} else if err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupted
+	}
+	return payload, nil
+}
+
+// readNode returns the node at the offset from the cache or the file
+func (db *DB) readNode(offset int64) (*node, error) {
+	db.mu.RLock()
+	n, ok := db.cache[offset]
+	db.mu.RUnlock()
+	if ok {
+		return n, nil
+	}
+	payload, err := db.readRecord(offset)
+	if err != nil {
+		return nil, err
+	}
+	if n, err = decodeNode(payload, offset); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	db.cache[offset] = n
+	db.mu.Unlock()
+	return n, nil
+}
+
+// encodeCatalog serializes the bucket roots ordered by name
+func encodeCatalog(catalog map[string]int64) []byte {
+	names := make([]string, 0, len(catalog))
+	for name := range catalog {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	buf := binary.AppendUvarint(nil, uint64(len(names)))
+	for _, name := range names {
+		buf = binary.AppendUvarint(buf, uint64(len(name)))
+		buf = append(buf, name...)
+		buf = binary.AppendUvarint(buf, uint64(catalog[name]))
+	}
+	return buf
+}
+
+// decodeCatalog parses a catalog record payload
+func decodeCatalog(payload []byte) (map[string]int64, error) {
+	d := &decoder{buf: payload}
+	count := d.uvarint()
+	if count > uint64(len(payload)) {
+		return nil, ErrCorrupted
+	}
+	catalog := make(map[string]int64, count)
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		name := string(d.bytes())
+		catalog[name] = int64(d.uvarint())
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return catalog, nil
+}
+
+// begin starts a transaction on the committed state
+func (db *DB) begin(writable bool) *Tx {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	catalog := make(map[string]int64, len(db.catalog))
+	for name, offset := range db.catalog {
+		catalog[name] = offset
+	}
+	return &Tx{db: db, writable: writable, meta: db.meta, catalog: catalog, roots: make(map[string]*node)}
+}
+
+// View runs fn in a read-only transaction
+func (db *DB) View(fn func(tx *Tx) error) error {
+	db.remap.RLock()
+	defer db.remap.RUnlock()
+	return fn(db.begin(false))
+}
+
+// Update runs fn in a write transaction, the changes are committed if fn
+// returns nil and discarded otherwise
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	db.remap.RLock()
+	defer db.remap.RUnlock()
+	db.writer.Lock()
+	defer db.writer.Unlock()
+	tx := db.begin(true)
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Size returns the size of the file
+func (db *DB) Size() int64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.meta.end
+}
+
+// Compact rewrites the live entries of all buckets to a new file that replaces
+// the current one, dropping the nodes replaced by earlier commits
+func (db *DB) Compact() error {
+	db.remap.Lock()
+	defer db.remap.Unlock()
+	temp := db.path + ".compact"
+	os.Remove(temp)
+	// the temp file is removed unless it replaced the database file
+	defer os.Remove(temp)
+	target, err := Open(temp, &Options{NoSync: true})
+	if err != nil {
+		return err
+	}
+	source := db.begin(false)
+	err = target.Update(func(tx *Tx) error {
+		for name := range source.catalog {
+			bucket, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			cursor := source.Bucket(name).Cursor()
+			key, value, err := cursor.First()
+			for ; err == nil && key != nil; key, value, err = cursor.Next() {
+				if err := bucket.Put(key, value); err != nil {
+					return err
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = target.file.Sync()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp, db.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(db.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	db.file.Close()
+	return db.open()
+}
+
+// Close closes the file
+func (db *DB) Close() error {
+	db.remap.Lock()
+	defer db.remap.Unlock()
+	return db.file.Close()
+}
@@ -0,0 +1,213 @@
+package kv
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTemp opens a database in a temporary directory
+func openTemp(t *testing.T) (*DB, string) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := Open(path, &Options{NoSync: true})
+	require.NoError(t, err)
+	return db, path
+}
+
+// keys returns the keys of the bucket in cursor order, backwards if reverse
+func keys(t *testing.T, db *DB, name string, reverse bool) []string {
+	var result []string
+	require.NoError(t, db.View(func(tx *Tx) error {
+		cursor := tx.Bucket(name).Cursor()
+		move, key := cursor.Next, []byte(nil)
+		var err error
+		if reverse {
+			move = cursor.Prev
+			key, _, err = cursor.Last()
+		} else {
+			key, _, err = cursor.First()
+		}
+		for ; err == nil && key != nil; key, _, err = move() {
+			result = append(result, string(key))
+		}
+		return err
+	}))
+	return result
+}
+
+func TestDB_PutGet(t *testing.T) {
+	db, path := openTemp(t)
+
+	// keys in random order split the tree over several levels
+	expected := make([]string, 0)
+	err := db.Update(func(tx *Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists("links")
+		if err != nil {
+			return err
+		}
+		for _, i := range rand.Perm(5000) {
+			key := fmt.Sprintf("key%05d", i)
+			expected = append(expected, key)
+			if err := bucket.Put([]byte(key), []byte("value"+key)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	sort.Strings(expected)
+	assert.Equal(t, expected, keys(t, db, "links", false))
+
+	// the data survives a reopen
+	require.NoError(t, db.Close())
+	db, err = Open(path, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	require.NoError(t, db.View(func(tx *Tx) error {
+		assert.Nil(t, tx.Bucket("missing"))
+		bucket := tx.Bucket("links")
+		value, err := bucket.Get([]byte("key01234"))
+		require.NoError(t, err)
+		assert.Equal(t, "valuekey01234", string(value))
+		value, err = bucket.Get([]byte("nokey"))
+		require.NoError(t, err)
+		assert.Nil(t, value)
+
+		cursor := bucket.Cursor()
+		key, _, err := cursor.Seek([]byte("key04999x"))
+		require.NoError(t, err)
+		assert.Nil(t, key)
+		key, _, err = cursor.Seek([]byte("key02000x"))
+		require.NoError(t, err)
+		assert.Equal(t, "key02001", string(key))
+		key, _, err = cursor.Prev()
+		require.NoError(t, err)
+		assert.Equal(t, "key02000", string(key))
+		return nil
+	}))
+	reversed := keys(t, db, "links", true)
+	assert.Len(t, reversed, 5000)
+	assert.Equal(t, "key04999", reversed[0])
+	assert.Equal(t, "key00000", reversed[4999])
+}
+
+func TestDB_Delete(t *testing.T) {
+	db, _ := openTemp(t)
+	defer db.Close()
+
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		bucket, _ := tx.CreateBucketIfNotExists("links")
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, bucket.Put([]byte(fmt.Sprintf("key%04d", i)), []byte("value")))
+		}
+		return nil
+	}))
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		bucket := tx.Bucket("links")
+		for i := 0; i < 1000; i++ {
+			if i%10 != 0 {
+				require.NoError(t, bucket.Delete([]byte(fmt.Sprintf("key%04d", i))))
+			}
+		}
+		return bucket.Delete([]byte("missing"))
+	}))
+	remaining := keys(t, db, "links", false)
+	assert.Len(t, remaining, 100)
+	assert.Equal(t, "key0990", remaining[99])
+
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		bucket := tx.Bucket("links")
+		for _, key := range remaining {
+			require.NoError(t, bucket.Delete([]byte(key)))
+		}
+		return nil
+	}))
+	assert.Empty(t, keys(t, db, "links", false))
+}
+
+func TestDB_Rollback(t *testing.T) {
+	db, _ := openTemp(t)
+	defer db.Close()
+
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		bucket, _ := tx.CreateBucketIfNotExists("links")
+		return bucket.Put([]byte("a"), []byte("1"))
+	}))
+	// a failed transaction leaves no trace
+	err := db.Update(func(tx *Tx) error {
+		require.NoError(t, tx.Bucket("links").Put([]byte("b"), []byte("2")))
+		return fmt.Errorf("abort")
+	})
+	assert.EqualError(t, err, "abort")
+	assert.Equal(t, []string{"a"}, keys(t, db, "links", false))
+
+	// a read transaction keeps its snapshot
+	require.NoError(t, db.View(func(tx *Tx) error {
+		require.NoError(t, db.Update(func(tx *Tx) error {
+			return tx.Bucket("links").Put([]byte("c"), []byte("3"))
+		}))
+		value, err := tx.Bucket("links").Get([]byte("c"))
+		require.NoError(t, err)
+		assert.Nil(t, value)
+		assert.ErrorIs(t, tx.Bucket("links").Put([]byte("d"), []byte("4")), ErrTxNotWritable)
+		return nil
+	}))
+	assert.Equal(t, []string{"a", "c"}, keys(t, db, "links", false))
+}
+
+func TestDB_TornCommit(t *testing.T) {
+	db, path := openTemp(t)
+	require.NoError(t, db.Update(func(tx *Tx) error {
+		bucket, _ := tx.CreateBucketIfNotExists("links")
+		return bucket.Put([]byte("a"), []byte("1"))
+	}))
+	size := db.Size()
+	require.NoError(t, db.Close())
+
+	// data appended without a meta update is dropped on open
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0666)
+	require.NoError(t, err)
+	_, err = file.Write([]byte("partial commit"))
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	db, err = Open(path, nil)
+	require.NoError(t, err)
+	defer db.Close()
+	assert.Equal(t, size, db.Size())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, size, info.Size())
+	assert.Equal(t, []string{"a"}, keys(t, db, "links", false))
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing", "test.db"), nil)
+	assert.Error(t, err)
+}
+
+func TestDB_Compact(t *testing.T) {
+	db, _ := openTemp(t)
+	defer db.Close()
+
+	for i := 0; i < 200; i++ {
+		require.NoError(t, db.Update(func(tx *Tx) error {
+			bucket, _ := tx.CreateBucketIfNotExists("links")
+			return bucket.Put([]byte(fmt.Sprintf("key%03d", i%50)), []byte(fmt.Sprintf("value%d", i)))
+		}))
+	}
+	before := db.Size()
+	require.NoError(t, db.Compact())
+	assert.Less(t, db.Size(), before/10)
+
+	require.NoError(t, db.View(func(tx *Tx) error {
+		value, err := tx.Bucket("links").Get([]byte("key049"))
+		assert.Equal(t, "value199", string(value))
+		return err
+	}))
+	assert.Len(t, keys(t, db, "links", false), 50)
+}
@@ -0,0 +1,178 @@
+package kv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+)
+
+// maxKeys number of keys a node holds before it is split
+const maxKeys = 32
+
+// node of the B+tree. Leaves hold keys and values, branches hold the first key
+// of every child and the child offsets. Nodes read from the file are shared
+// between transactions and never modified, a write transaction modifies copies.
+type node struct {
+	leaf     bool
+	keys     [][]byte
+	values   [][]byte
+	children []int64
+	// childNodes in-memory children of a copied branch, nil entries are read from the file
+	childNodes []*node
+	// offset of the node record in the file, 0 for a node not written yet
+	offset int64
+}
+
+// dirty reports whether the node was created or copied by the current transaction
+func (n *node) dirty() bool {
+	return n.offset == 0
+}
+
+// clone returns a modifiable copy of the node
+func (n *node) clone() *node {
+	c := &node{leaf: n.leaf, keys: append([][]byte(nil), n.keys...)}
+	if n.leaf {
+		c.values = append([][]byte(nil), n.values...)
+	} else {
+		c.children = append([]int64(nil), n.children...)
+		c.childNodes = make([]*node, len(n.children))
+	}
+	return c
+}
+
+// search returns the index of the first key not less than key
+func (n *node) search(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) >= 0
+	})
+}
+
+// childIndex returns the index of the child of a branch that may hold key
+func (n *node) childIndex(key []byte) int {
+	i := sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) > 0
+	})
+	return max(i-1, 0)
+}
+
+// split moves the upper half of an overfull node to a new node and returns it,
+// nil if the node is not full
+func (n *node) split() *node {
+	if len(n.keys) <= maxKeys {
+		return nil
+	}
+	mid := len(n.keys) / 2
+	right := &node{leaf: n.leaf, keys: append([][]byte(nil), n.keys[mid:]...)}
+	n.keys = n.keys[:mid:mid]
+	if n.leaf {
+		right.values = append([][]byte(nil), n.values[mid:]...)
+		n.values = n.values[:mid:mid]
+	} else {
+		right.children = append([]int64(nil), n.children[mid:]...)
+		right.childNodes = append([]*node(nil), n.childNodes[mid:]...)
+		n.children = n.children[:mid:mid]
+		n.childNodes = n.childNodes[:mid:mid]
+	}
+	return right
+}
+
+// remove deletes the entry at index i
+func (n *node) remove(i int) {
+	n.keys = append(n.keys[:i:i], n.keys[i+1:]...)
+	if n.leaf {
+		n.values = append(n.values[:i:i], n.values[i+1:]...)
+		return
+	}
+	n.children = append(n.children[:i:i], n.children[i+1:]...)
+	n.childNodes = append(n.childNodes[:i:i], n.childNodes[i+1:]...)
+}
+
+// insertAt returns the slice with value inserted at index i
+func insertAt[T any](slice []T, i int, value T) []T {
+	slice = append(slice, value)
+	copy(slice[i+1:], slice[i:])
+	slice[i] = value
+	return slice
+}
+
+// encode serializes the node, children are referenced by their offsets
+func (n *node) encode() []byte {
+	buf := make([]byte, 0, 64)
+	if n.leaf {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(n.keys)))
+	for i, key := range n.keys {
+		buf = binary.AppendUvarint(buf, uint64(len(key)))
+		buf = append(buf, key...)
+		if n.leaf {
+			buf = binary.AppendUvarint(buf, uint64(len(n.values[i])))
+			buf = append(buf, n.values[i]...)
+		} else {
+			buf = binary.AppendUvarint(buf, uint64(n.children[i]))
+		}
+	}
+	return buf
+}
+
+// decoder reads the fields of a record payload
+type decoder struct {
+	buf []byte
+	err error
+}
+
+// uvarint reads a varint
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	value, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = ErrCorrupted
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return value
+}
+
+// bytes reads a length-prefixed byte string
+func (d *decoder) bytes() []byte {
+	length := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.buf)) < length {
+		d.err = ErrCorrupted
+		return nil
+	}
+	value := d.buf[:length:length]
+	d.buf = d.buf[length:]
+	return value
+}
+
+// decodeNode parses a node record payload
+func decodeNode(payload []byte, offset int64) (*node, error) {
+	if len(payload) == 0 {
+		return nil, ErrCorrupted
+	}
+	n := &node{leaf: payload[0] == 1, offset: offset}
+	d := &decoder{buf: payload[1:]}
+	count := d.uvarint()
+	if count > uint64(len(d.buf)) {
+		return nil, ErrCorrupted
+	}
+	for i := uint64(0); i < count && d.err == nil; i++ {
+		n.keys = append(n.keys, d.bytes())
+		if n.leaf {
+			n.values = append(n.values, d.bytes())
+		} else {
+			n.children = append(n.children, int64(d.uvarint()))
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return n, nil
+}
@@ -0,0 +1,283 @@
+package kv
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Tx transaction on a snapshot of the database
+type Tx struct {
+	db       *DB
+	writable bool
+	meta     meta
+	// catalog committed bucket roots at the start of the transaction
+	catalog map[string]int64
+	// roots bucket roots used by the transaction, copied roots are written on commit
+	roots map[string]*node
+	// replaced offsets of the nodes copied by the transaction
+	replaced []int64
+	changed  bool
+}
+
+// Bucket ordered set of keys in a transaction
+type Bucket struct {
+	tx   *Tx
+	name string
+}
+
+// Bucket returns the bucket, nil if it does not exist
+func (tx *Tx) Bucket(name string) *Bucket {
+	if _, ok := tx.roots[name]; ok {
+		return &Bucket{tx: tx, name: name}
+	}
+	if _, ok := tx.catalog[name]; ok {
+		return &Bucket{tx: tx, name: name}
+	}
+	return nil
+}
+
+// CreateBucketIfNotExists returns the bucket and creates it if needed
+func (tx *Tx) CreateBucketIfNotExists(name string) (*Bucket, error) {
+	if bucket := tx.Bucket(name); bucket != nil {
+		return bucket, nil
+	}
+	if !tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	tx.roots[name] = &node{leaf: true}
+	tx.changed = true
+	return &Bucket{tx: tx, name: name}, nil
+}
+
+// root returns the root node of the bucket
+func (b *Bucket) root() (*node, error) {
+	if root, ok := b.tx.roots[b.name]; ok {
+		return root, nil
+	}
+	root, err := b.tx.db.readNode(b.tx.catalog[b.name])
+	if err != nil {
+		return nil, err
+	}
+	b.tx.roots[b.name] = root
+	return root, nil
+}
+
+// writableRoot returns the root node of the bucket, copied if it is shared
+func (b *Bucket) writableRoot() (*node, error) {
+	if !b.tx.writable {
+		return nil, ErrTxNotWritable
+	}
+	root, err := b.root()
+	if err != nil {
+		return nil, err
+	}
+	if !root.dirty() {
+		b.tx.replaced = append(b.tx.replaced, root.offset)
+		root = root.clone()
+		b.tx.roots[b.name] = root
+	}
+	b.tx.changed = true
+	return root, nil
+}
+
+// child returns the child i of a branch
+func (tx *Tx) child(n *node, i int) (*node, error) {
+	if n.childNodes != nil && n.childNodes[i] != nil {
+		return n.childNodes[i], nil
+	}
+	return tx.db.readNode(n.children[i])
+}
+
+// writableChild returns the child i of a copied branch, copied if it is shared
+func (tx *Tx) writableChild(n *node, i int) (*node, error) {
+	child, err := tx.child(n, i)
+	if err != nil {
+		return nil, err
+	}
+	if !child.dirty() {
+		tx.replaced = append(tx.replaced, child.offset)
+		child = child.clone()
+		n.childNodes[i] = child
+	}
+	return child, nil
+}
+
+// Get returns the value of the key, nil if the key is missing. The value is
+// valid for the life of the transaction and must not be modified.
+func (b *Bucket) Get(key []byte) ([]byte, error) {
+	n, err := b.root()
+	for err == nil && !n.leaf {
+		n, err = b.tx.child(n, n.childIndex(key))
+	}
+	if err != nil {
+		return nil, err
+	}
+	i := n.search(key)
+	if i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+		return n.values[i], nil
+	}
+	return nil, nil
+}
+
+// Put sets the value of the key
+func (b *Bucket) Put(key, value []byte) error {
+	root, err := b.writableRoot()
+	if err != nil {
+		return err
+	}
+	key = append([]byte(nil), key...)
+	value = append([]byte(nil), value...)
+	right, err := b.tx.insert(root, key, value)
+	if err != nil {
+		return err
+	}
+	if right != nil {
+		b.tx.roots[b.name] = &node{
+			keys:       [][]byte{root.keys[0], right.keys[0]},
+			children:   []int64{0, 0},
+			childNodes: []*node{root, right},
+		}
+	}
+	return nil
+}
+
+// insert puts the key into the subtree of a copied node and returns the new
+// right sibling if the node was split
+func (tx *Tx) insert(n *node, key, value []byte) (*node, error) {
+	if n.leaf {
+		i := n.search(key)
+		if i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+			n.values[i] = value
+			return nil, nil
+		}
+		n.keys = insertAt(n.keys, i, key)
+		n.values = insertAt(n.values, i, value)
+		return n.split(), nil
+	}
+	i := n.childIndex(key)
+	child, err := tx.writableChild(n, i)
+	if err != nil {
+		return nil, err
+	}
+	right, err := tx.insert(child, key, value)
+	if err != nil {
+		return nil, err
+	}
+	n.keys[i] = child.keys[0]
+	if right != nil {
+		n.keys = insertAt(n.keys, i+1, right.keys[0])
+		n.children = insertAt(n.children, i+1, 0)
+		n.childNodes = insertAt(n.childNodes, i+1, right)
+	}
+	return n.split(), nil
+}
+
+// Delete removes the key, a missing key is ignored. Nodes are not merged,
+// empty nodes are removed from their parent.
+func (b *Bucket) Delete(key []byte) error {
+	value, err := b.Get(key)
+	if err != nil || value == nil {
+		return err
+	}
+	root, err := b.writableRoot()
+	if err != nil {
+		return err
+	}
+	if err := b.tx.delete(root, key); err != nil {
+		return err
+	}
+	// a branch with a single child is replaced by the child
+	for !root.leaf && len(root.keys) == 1 {
+		if root, err = b.tx.child(root, 0); err != nil {
+			return err
+		}
+		b.tx.roots[b.name] = root
+	}
+	if !root.leaf && len(root.keys) == 0 {
+		b.tx.roots[b.name] = &node{leaf: true}
+	}
+	return nil
+}
+
+// delete removes the existing key from the subtree of a copied node
+func (tx *Tx) delete(n *node, key []byte) error {
+	if n.leaf {
+		n.remove(n.search(key))
+		return nil
+	}
+	i := n.childIndex(key)
+	child, err := tx.writableChild(n, i)
+	if err != nil {
+		return err
+	}
+	if err := tx.delete(child, key); err != nil {
+		return err
+	}
+	if len(child.keys) == 0 {
+		n.remove(i)
+	} else {
+		n.keys[i] = child.keys[0]
+	}
+	return nil
+}
+
+// commit appends the copied nodes and the new catalog and switches the meta to them
+func (tx *Tx) commit() error {
+	if !tx.changed {
+		return nil
+	}
+	db := tx.db
+	end := tx.meta.end
+	var buf []byte
+	written := make([]*node, 0)
+	var write func(n *node) int64
+	write = func(n *node) int64 {
+		if !n.dirty() {
+			return n.offset
+		}
+		for i, child := range n.childNodes {
+			if child != nil {
+				n.children[i] = write(child)
+			}
+		}
+		n.offset = end + int64(len(buf))
+		n.childNodes = nil
+		buf = appendRecord(buf, n.encode())
+		written = append(written, n)
+		return n.offset
+	}
+	catalog := make(map[string]int64, len(tx.catalog)+len(tx.roots))
+	for name, offset := range tx.catalog {
+		catalog[name] = offset
+	}
+	names := make([]string, 0, len(tx.roots))
+	for name := range tx.roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		catalog[name] = write(tx.roots[name])
+	}
+	catalogOffset := end + int64(len(buf))
+	buf = appendRecord(buf, encodeCatalog(catalog))
+
+	if _, err := db.file.WriteAt(buf, end); err != nil {
+		return err
+	}
+	if err := db.sync(); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.writeMeta(meta{txid: tx.meta.txid + 1, catalog: catalogOffset, end: end + int64(len(buf))}); err != nil {
+		return err
+	}
+	db.catalog = catalog
+	for _, offset := range tx.replaced {
+		delete(db.cache, offset)
+	}
+	for _, n := range written {
+		db.cache[n.offset] = n
+	}
+	return nil
+}
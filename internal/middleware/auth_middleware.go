@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"net/http"
+	"strings"
+)
+
+// WithAdminAuth is a middleware that allows the request only with the admin token
+// in the Authorization: Bearer header; without a configured token admin routes are disabled
+func WithAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := config.Config.AdminToken
+		if token == "" {
+			log.Infof("Admin token is not configured")
+			http.Error(w, "Admin API is disabled", http.StatusForbidden)
+			return
+		}
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			log.Infof("Admin token is invalid")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -19,6 +19,16 @@ func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
+// Flush sends the data compressed so far to the client
+func (w gzipWriter) Flush() {
+	if gz, ok := w.Writer.(*gzip.Writer); ok {
+		gz.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 // WithCompressing is a middleware that compresses the request body if Content-Encoding == gzip
 // and compresses the response body if Accept-Encoding == gzip
 func WithCompressing(next http.Handler) http.Handler {
@@ -127,6 +127,40 @@ func TestWithCompressing(t *testing.T) {
 	}
 }
 
+// TestWithCompressingFlush tests that a flush sends the data compressed so far
+func TestWithCompressingFlush(t *testing.T) {
+	setup()
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatalf("Expected the response writer to be an http.Flusher")
+		}
+		flusher.Flush()
+		if !rr.Flushed {
+			t.Errorf("Expected the response to be flushed")
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(rr.Body.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to create gzip reader: %v", err)
+		}
+		flushed := make([]byte, len(payload))
+		if _, err := io.ReadFull(gz, flushed); err != nil || !bytes.Equal(flushed, payload) {
+			t.Errorf("Unexpected flushed content. Got %s, want %s (%v)", flushed, payload, err)
+		}
+		w.Write(payload)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	WithLogging(WithCompressing(handler)).ServeHTTP(rr, req)
+
+	if decompressed := decompressBody(rr.Body.Bytes()); !bytes.Equal(decompressed, append(payload, payload...)) {
+		t.Errorf("Unexpected decompressed response content. Got %s", decompressed)
+	}
+}
+
 // compressBody is a helper function to gzip compress a body
 func compressBody(body []byte) []byte {
 	var buf bytes.Buffer
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// WithFollower returns a middleware for write routes, while readOnly reports a
+// read-only storage the request is forwarded to the configured primary or
+// rejected with 503 without one
+func WithFollower(readOnly func() bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return withFollower(readOnly, next)
+	}
+}
+
+func withFollower(readOnly func() bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !readOnly() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if config.Config.PrimaryURL == "" {
+			log.Infof("Rejecting write on read-only follower: %s %s", r.Method, r.URL.Path)
+			http.Error(w, "Read-only follower, writes go to the primary", http.StatusServiceUnavailable)
+			return
+		}
+		primary, err := url.Parse(config.Config.PrimaryURL)
+		if err != nil {
+			log.Error(err)
+			http.Error(w, "Invalid primary URL", http.StatusBadGateway)
+			return
+		}
+		log.Infof("Forwarding write to primary %s: %s %s", primary, r.Method, r.URL.Path)
+		forwarded := r.Clone(r.Context())
+		// WithCompressing has already decompressed the body and compresses the response
+		forwarded.Header.Del("Accept-Encoding")
+		if forwarded.Header.Get("Content-Encoding") == "gzip" {
+			forwarded.Header.Del("Content-Encoding")
+			forwarded.Header.Del("Content-Length")
+			forwarded.ContentLength = -1
+		}
+		proxy := httputil.NewSingleHostReverseProxy(primary)
+		proxy.ModifyResponse = func(res *http.Response) error {
+			res.Header.Del("Content-Length")
+			return nil
+		}
+		proxy.ServeHTTP(w, forwarded)
+	})
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"bytes"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestWithFollower tests passing, rejecting and forwarding of write requests
+func TestWithFollower(t *testing.T) {
+	setup()
+	defer func() { config.Config = config.AppConfig{} }()
+
+	// primary echoes the request body
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append([]byte("primary: "), body...))
+	}))
+	defer primary.Close()
+
+	testCases := []struct {
+		name         string
+		readOnly     bool
+		primaryURL   string
+		gzipped      bool
+		expectedCode int
+		expectedBody []byte
+	}{
+		{
+			name:         "Primary handles writes",
+			expectedCode: http.StatusOK,
+			expectedBody: payload,
+		},
+		{
+			name:         "Follower without primary rejects writes",
+			readOnly:     true,
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: []byte("Read-only follower, writes go to the primary\n"),
+		},
+		{
+			name:         "Follower forwards writes to primary",
+			readOnly:     true,
+			primaryURL:   primary.URL,
+			expectedCode: http.StatusCreated,
+			expectedBody: append([]byte("primary: "), payload...),
+		},
+		{
+			name:         "Follower forwards gzipped writes to primary",
+			readOnly:     true,
+			primaryURL:   primary.URL,
+			gzipped:      true,
+			expectedCode: http.StatusCreated,
+			expectedBody: append([]byte("primary: "), payload...),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config.Config.PrimaryURL = tc.primaryURL
+
+			// local handler echoes the request body
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mockHandler(w, r, body)
+			})
+			wrappedHandler := WithCompressing(WithFollower(func() bool { return tc.readOnly })(handler))
+
+			body := payload
+			if tc.gzipped {
+				body = compressBody(payload)
+			}
+			req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+			if tc.gzipped {
+				req.Header.Set("Content-Encoding", "gzip")
+				req.Header.Set("Accept-Encoding", "gzip")
+			}
+
+			rr := httptest.NewRecorder()
+			wrappedHandler.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expectedCode {
+				t.Errorf("Unexpected status code. Got %d, want %d", rr.Code, tc.expectedCode)
+			}
+			responseBody := rr.Body.Bytes()
+			if tc.gzipped {
+				responseBody = decompressBody(responseBody)
+			}
+			if !bytes.Equal(responseBody, tc.expectedBody) {
+				t.Errorf("Unexpected response content. Got %s, want %s", responseBody, tc.expectedBody)
+			}
+		})
+	}
+}
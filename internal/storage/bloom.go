@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"hash/fnv"
+	"io"
+	"math"
+	"sync"
+)
+
+// minBloomCapacity smallest number of keys a filter is sized for
+const minBloomCapacity = 1 << 16
+
+// BloomFilter set membership test without false negatives, a key that was
+// never added is reported as present with about the configured probability
+type BloomFilter struct {
+	bits     []uint64
+	m        uint64
+	k        uint64
+	count    int
+	capacity int
+}
+
+// NewBloomFilter creates a filter for capacity keys with the false-positive
+// rate fpRate, the rate grows when more keys are added
+func NewBloomFilter(capacity int, fpRate float64) *BloomFilter {
+	n := float64(max(capacity, 1))
+	m := uint64(math.Ceil(-n * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(math.Round(float64(m) / n * math.Ln2))
+	return &BloomFilter{
+		bits:     make([]uint64, (m+63)/64),
+		m:        m,
+		k:        max(k, 1),
+		capacity: capacity,
+	}
+}
+
+// positions calls fn with the k bit positions of the key, using double hashing
+func (f *BloomFilter) positions(key string, fn func(position uint64) bool) {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	sum := hash.Sum64()
+	h1, h2 := sum&math.MaxUint32, sum>>32|1
+	for i := uint64(0); i < f.k; i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return
+		}
+	}
+}
+
+// Add adds the key to the filter
+func (f *BloomFilter) Add(key string) {
+	f.positions(key, func(position uint64) bool {
+		f.bits[position/64] |= 1 << (position % 64)
+		return true
+	})
+	f.count++
+}
+
+// MayContain reports false if the key was never added
+func (f *BloomFilter) MayContain(key string) bool {
+	found := true
+	f.positions(key, func(position uint64) bool {
+		found = f.bits[position/64]&(1<<(position%64)) != 0
+		return found
+	})
+	return found
+}
+
+// Full reports whether more keys than the capacity were added
+func (f *BloomFilter) Full() bool {
+	return f.count > f.capacity
+}
+
+// BloomStorage answers lookups of short URLs that were never added without
+// reaching the wrapped storage. The filter is built from the storage on start,
+// updated on every add and rebuilt twice as large once it is full. The full
+// filter keeps answering lookups while the new one is built.
+type BloomStorage struct {
+	Storage
+	mu     sync.RWMutex
+	filter *BloomFilter
+	fpRate float64
+	// pending hashes added to the filter whose write is in progress
+	pending map[string]int
+	// added hashes added while the filter is rebuilt, nil if no rebuild is running
+	added []string
+}
+
+// NewBloomStorage wraps the storage with a bloom filter of its short URLs with
+// the false-positive rate fpRate
+func NewBloomStorage(s Storage, fpRate float64) (*BloomStorage, error) {
+	if fpRate <= 0 || fpRate >= 1 {
+		return nil, fmt.Errorf("bloom filter false-positive rate must be between 0 and 1: %v", fpRate)
+	}
+	bloom := &BloomStorage{Storage: s, fpRate: fpRate, pending: make(map[string]int)}
+	if err := bloom.rebuild(0); err != nil {
+		return nil, err
+	}
+	return bloom, nil
+}
+
+// rebuild fills a new filter with all short URLs of the storage, sized for
+// twice their number. The storage is read without holding the lock, the hashes
+// added meanwhile are recorded and added to the new filter when it is swapped
+// in. A rebuild started while another one runs does nothing.
+func (b *BloomStorage) rebuild(minCapacity int) error {
+	b.mu.Lock()
+	if b.added != nil {
+		b.mu.Unlock()
+		return nil
+	}
+	// writes in progress may not be in the storage when it is read
+	b.added = make([]string, 0, len(b.pending))
+	for hash := range b.pending {
+		b.added = append(b.added, hash)
+	}
+	b.mu.Unlock()
+
+	hashes := make([]string, 0)
+	err := b.Storage.Range(0, false, func(row DataRow) bool {
+		hashes = append(hashes, row.ShortURL)
+		return true
+	})
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	added := b.added
+	b.added = nil
+	if err != nil {
+		return err
+	}
+	capacity := max(2*(len(hashes)+len(added)), minCapacity, minBloomCapacity)
+	filter := NewBloomFilter(capacity, b.fpRate)
+	for _, hash := range hashes {
+		filter.Add(hash)
+	}
+	for _, hash := range added {
+		filter.Add(hash)
+	}
+	log.Infof("Bloom filter built for %d short URLs, capacity %d", len(hashes), capacity)
+	b.filter = filter
+	return nil
+}
+
+// add puts the hash into the filter before it is written, so a concurrent
+// lookup never misses a stored record; a failed write leaves a false positive.
+// The returned func is called once the write is done.
+func (b *BloomStorage) add(hash string) (func(), error) {
+	b.mu.Lock()
+	b.filter.Add(hash)
+	b.pending[hash]++
+	if b.added != nil {
+		b.added = append(b.added, hash)
+	}
+	full, capacity := b.filter.Full() && b.added == nil, b.filter.capacity
+	b.mu.Unlock()
+	if full {
+		if err := b.rebuild(2 * capacity); err != nil {
+			b.mu.Lock()
+			b.done(hash)
+			b.mu.Unlock()
+			return nil, err
+		}
+	}
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.done(hash)
+	}, nil
+}
+
+// done removes the hash from the writes in progress, the caller holds the write lock
+func (b *BloomStorage) done(hash string) {
+	if b.pending[hash]--; b.pending[hash] <= 0 {
+		delete(b.pending, hash)
+	}
+}
+
+// AddURL adds the hash to the filter and adds the URL
+func (b *BloomStorage) AddURL(hash, url string) error {
+	done, err := b.add(hash)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return b.Storage.AddURL(hash, url)
+}
+
+// AddRow adds the hash to the filter and adds the record
+func (b *BloomStorage) AddRow(row DataRow) error {
+	done, err := b.add(row.ShortURL)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return b.Storage.AddRow(row)
+}
+
+// MayContain reports false if the hash is not in the storage
+func (b *BloomStorage) MayContain(hash string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.filter.MayContain(hash)
+}
+
+// GetURL retrieves a URL unless the filter rules it out
+func (b *BloomStorage) GetURL(hash string) (string, bool, error) {
+	if !b.MayContain(hash) {
+		return "", false, nil
+	}
+	return b.Storage.GetURL(hash)
+}
+
+// GetRow retrieves a record unless the filter rules it out
+func (b *BloomStorage) GetRow(hash string) (DataRow, bool, error) {
+	if !b.MayContain(hash) {
+		return DataRow{}, false, nil
+	}
+	return b.Storage.GetRow(hash)
+}
+
+// Unwrap returns the wrapped storage
+func (b *BloomStorage) Unwrap() Storage {
+	return b.Storage
+}
+
+// Close closes the wrapped storage
+func (b *BloomStorage) Close() error {
+	if closer, ok := b.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
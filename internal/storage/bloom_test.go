@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBloomFilter(t *testing.T) {
+	filter := NewBloomFilter(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.Add(fmt.Sprintf("added%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		require.True(t, filter.MayContain(fmt.Sprintf("added%d", i)))
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if filter.MayContain(fmt.Sprintf("missing%d", i)) {
+			falsePositives++
+		}
+	}
+	assert.Less(t, falsePositives, 200)
+	assert.False(t, filter.Full())
+}
+
+func TestBloomStorage(t *testing.T) {
+	backend := newCountingStorage(t)
+	require.NoError(t, backend.AddURL("short1", "http://example1.com"))
+	_, err := NewBloomStorage(backend, 1)
+	assert.Error(t, err)
+	bloom, err := NewBloomStorage(backend, 0.01)
+	require.NoError(t, err)
+
+	// records present on start and added later are found
+	require.NoError(t, bloom.AddURL("short2", "http://example2.com"))
+	for _, hash := range []string{"short1", "short2"} {
+		_, ok, err := bloom.GetRow(hash)
+		require.NoError(t, err)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, 2, backend.lookups)
+
+	// missing records do not reach the storage
+	_, ok, err := bloom.GetRow("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, 2, backend.lookups)
+
+	// a full filter is rebuilt larger, keeping the record being written
+	bloom.filter = NewBloomFilter(0, 0.01)
+	require.NoError(t, bloom.AddURL("short3", "http://example3.com"))
+	assert.Equal(t, minBloomCapacity, bloom.filter.capacity)
+	for _, hash := range []string{"short1", "short2", "short3"} {
+		assert.True(t, bloom.MayContain(hash))
+	}
+	assert.Empty(t, bloom.pending)
+	assert.Same(t, backend, Unwrap(bloom))
+}
+
+// blockingStorage blocks Range until release is closed
+type blockingStorage struct {
+	Storage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStorage) Range(cursor int64, desc bool, fn func(row DataRow) bool) error {
+	close(b.started)
+	<-b.release
+	return b.Storage.Range(cursor, desc, fn)
+}
+
+func TestBloomStorage_RebuildUnlocked(t *testing.T) {
+	backend := newCountingStorage(t)
+	require.NoError(t, backend.AddURL("short1", "http://example1.com"))
+	bloom, err := NewBloomStorage(backend, 0.01)
+	require.NoError(t, err)
+
+	// the full filter answers lookups and takes writes while the new one is built
+	blocking := &blockingStorage{Storage: backend, started: make(chan struct{}), release: make(chan struct{})}
+	bloom.Storage = blocking
+	bloom.filter.count = bloom.filter.capacity
+	rebuilt := make(chan error)
+	go func() {
+		rebuilt <- bloom.AddURL("short2", "http://example2.com")
+	}()
+	<-blocking.started
+	assert.True(t, bloom.MayContain("short1"))
+	assert.False(t, bloom.MayContain("missing"))
+	require.NoError(t, bloom.AddURL("short3", "http://example3.com"))
+	close(blocking.release)
+	require.NoError(t, <-rebuilt)
+
+	assert.False(t, bloom.filter.Full())
+	for _, hash := range []string{"short1", "short2", "short3"} {
+		assert.True(t, bloom.MayContain(hash))
+	}
+	assert.Nil(t, bloom.added)
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"time"
+)
+
+// CacheStats counters of a CachedStorage
+type CacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+	Size    int   `json:"size"`
+}
+
+// cacheEntry cached lookup result, a negative entry records a missing hash
+type cacheEntry struct {
+	hash    string
+	row     DataRow
+	found   bool
+	expires time.Time
+}
+
+// CachedStorage is a read-through LRU cache of record lookups in front of any
+// storage. Lookups of missing hashes are cached for a short TTL, so probing for
+// unknown links does not reach the storage every time. Writes go to the wrapped
+// storage and drop the cached entry of the hash. Listing and iteration are not cached.
+type CachedStorage struct {
+	Storage
+	mu          sync.Mutex
+	size        int
+	negativeTTL time.Duration
+	entries     map[string]*list.Element
+	// order most recently used entries first
+	order *list.List
+	// generation changes on every write, a lookup started before a write is not cached
+	generation uint64
+	hits       int64
+	misses     int64
+}
+
+// NewCachedStorage wraps the storage with a cache of up to size records, missing
+// hashes are cached for negativeTTL, 0 disables negative entries
+func NewCachedStorage(s Storage, size int, negativeTTL time.Duration) *CachedStorage {
+	return &CachedStorage{
+		Storage:     s,
+		size:        size,
+		negativeTTL: negativeTTL,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// AddURL adds a URL and drops its cached entry
+func (c *CachedStorage) AddURL(hash, url string) error {
+	defer c.invalidate(hash)
+	return c.Storage.AddURL(hash, url)
+}
+
+// AddRow adds a record and drops its cached entry
+func (c *CachedStorage) AddRow(row DataRow) error {
+	defer c.invalidate(row.ShortURL)
+	return c.Storage.AddRow(row)
+}
+
+// UpdateRow updates a record and drops its cached entry
+func (c *CachedStorage) UpdateRow(row DataRow) error {
+	defer c.invalidate(row.ShortURL)
+	return c.Storage.UpdateRow(row)
+}
+
+// GetURL retrieves a URL through the cache
+func (c *CachedStorage) GetURL(hash string) (string, bool, error) {
+	row, ok, err := c.GetRow(hash)
+	return row.OriginalURL, ok, err
+}
+
+// GetRow retrieves a record through the cache
+func (c *CachedStorage) GetRow(hash string) (DataRow, bool, error) {
+	c.mu.Lock()
+	if element, ok := c.entries[hash]; ok {
+		entry := element.Value.(*cacheEntry)
+		if entry.found || time.Now().Before(entry.expires) {
+			c.order.MoveToFront(element)
+			c.hits++
+			c.mu.Unlock()
+			return entry.row, entry.found, nil
+		}
+		c.remove(element)
+	}
+	c.misses++
+	generation := c.generation
+	c.mu.Unlock()
+
+	row, ok, err := c.Storage.GetRow(hash)
+	if err != nil {
+		return DataRow{}, false, err
+	}
+	if ok || c.negativeTTL > 0 {
+		c.put(generation, &cacheEntry{hash: hash, row: row, found: ok, expires: time.Now().Add(c.negativeTTL)})
+	}
+	return row, ok, nil
+}
+
+// put caches the entry unless a write happened since the lookup started
+func (c *CachedStorage) put(generation uint64, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation || c.size <= 0 {
+		return
+	}
+	if element, ok := c.entries[entry.hash]; ok {
+		c.remove(element)
+	}
+	c.entries[entry.hash] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// invalidate drops the cached entry of the hash
+func (c *CachedStorage) invalidate(hash string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if element, ok := c.entries[hash]; ok {
+		c.remove(element)
+	}
+}
+
+// remove drops the element, the caller holds the lock
+func (c *CachedStorage) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).hash)
+}
+
+// Stats returns the hit and miss counters and the number of cached entries
+func (c *CachedStorage) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Entries: c.order.Len(), Size: c.size}
+}
+
+// Unwrap returns the wrapped storage
+func (c *CachedStorage) Unwrap() Storage {
+	return c.Storage
+}
+
+// Close closes the wrapped storage
+func (c *CachedStorage) Close() error {
+	if closer, ok := c.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Unwrap returns the storage below decorators such as CachedStorage
+func Unwrap(s Storage) Storage {
+	for {
+		wrapper, ok := s.(interface{ Unwrap() Storage })
+		if !ok {
+			return s
+		}
+		s = wrapper.Unwrap()
+	}
+}
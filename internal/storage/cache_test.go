@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStorage counts the lookups reaching the wrapped storage
+type countingStorage struct {
+	Storage
+	lookups int
+}
+
+func (s *countingStorage) GetRow(hash string) (DataRow, bool, error) {
+	s.lookups++
+	return s.Storage.GetRow(hash)
+}
+
+// newCountingStorage creates a file storage on a temporary file
+func newCountingStorage(t *testing.T) *countingStorage {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		os.Remove(file.Name())
+		os.Remove(file.Name() + ".lock")
+	})
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { storage.Close() })
+	return &countingStorage{Storage: storage}
+}
+
+func TestCachedStorage_ReadThrough(t *testing.T) {
+	backend := newCountingStorage(t)
+	cache := NewCachedStorage(backend, 2, time.Minute)
+	require.NoError(t, cache.AddURL("short1", "http://example1.com"))
+
+	for i := 0; i < 3; i++ {
+		url, ok, err := cache.GetURL("short1")
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "http://example1.com", url)
+	}
+	assert.Equal(t, 1, backend.lookups)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1, Entries: 1, Size: 2}, cache.Stats())
+
+	// an edit drops the cached record
+	row, _, err := cache.GetRow("short1")
+	require.NoError(t, err)
+	row.OriginalURL = "http://example1.org"
+	require.NoError(t, cache.UpdateRow(row))
+	url, _, err := cache.GetURL("short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example1.org", url)
+	assert.Equal(t, 2, backend.lookups)
+}
+
+func TestCachedStorage_Negative(t *testing.T) {
+	backend := newCountingStorage(t)
+	cache := NewCachedStorage(backend, 2, time.Minute)
+
+	// a missing hash is looked up once
+	for i := 0; i < 2; i++ {
+		_, ok, err := cache.GetURL("short1")
+		require.NoError(t, err)
+		assert.False(t, ok)
+	}
+	assert.Equal(t, 1, backend.lookups)
+
+	// adding the hash drops the negative entry
+	require.NoError(t, cache.AddURL("short1", "http://example1.com"))
+	_, ok, err := cache.GetURL("short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// negative entries expire
+	cache = NewCachedStorage(backend, 2, time.Millisecond)
+	_, _, err = cache.GetURL("short2")
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	backend.lookups = 0
+	_, _, err = cache.GetURL("short2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, backend.lookups)
+
+	// without a TTL missing hashes are not cached
+	cache = NewCachedStorage(backend, 2, 0)
+	_, _, err = cache.GetURL("short3")
+	require.NoError(t, err)
+	assert.Equal(t, 0, cache.Stats().Entries)
+}
+
+func TestCachedStorage_Evict(t *testing.T) {
+	backend := newCountingStorage(t)
+	cache := NewCachedStorage(backend, 2, time.Minute)
+	for _, hash := range []string{"short1", "short2", "short3"} {
+		require.NoError(t, cache.AddURL(hash, "http://example.com/"+hash))
+	}
+
+	// short1 is used recently, so short2 is evicted by short3
+	for _, hash := range []string{"short1", "short2", "short1", "short3"} {
+		_, _, err := cache.GetURL(hash)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, cache.Stats().Entries)
+	backend.lookups = 0
+	for _, hash := range []string{"short1", "short3", "short2"} {
+		_, _, err := cache.GetURL(hash)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 1, backend.lookups)
+
+	assert.Same(t, backend, Unwrap(cache))
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// checksum computes the CRC-32 of the JSON encoding of the record without its CRC
+func checksum(row DataRow) (uint32, error) {
+	row.CRC = 0
+	data, err := json.Marshal(&row)
+	if err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(data), nil
+}
+
+// decodeRow decodes a record line and validates its CRC if present
+func decodeRow(line []byte) (DataRow, error) {
+	var row DataRow
+	if err := json.Unmarshal(line, &row); err != nil {
+		return row, err
+	}
+	if row.CRC == 0 {
+		return row, nil
+	}
+	crc, err := checksum(row)
+	if err != nil {
+		return row, err
+	}
+	if crc != row.CRC {
+		return row, fmt.Errorf("checksum mismatch: stored %08x, computed %08x", row.CRC, crc)
+	}
+	return row, nil
+}
+
+// encodeRow writes a record as a single line, with a CRC if requested
+func encodeRow(w io.Writer, row *DataRow, withCRC bool) error {
+	row.CRC = 0
+	if withCRC {
+		crc, err := checksum(*row)
+		if err != nil {
+			return err
+		}
+		row.CRC = crc
+	}
+	return json.NewEncoder(w).Encode(row)
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"errors"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CompactReport result of a storage compaction
+type CompactReport struct {
+	Lines   int `json:"lines"`
+	Records int `json:"records"`
+	Expired int `json:"expired"`
+}
+
+// Compactor is implemented by storages that can drop superseded and expired records
+type Compactor interface {
+	// Compact rewrites the storage to only live records
+	Compact(now time.Time) (CompactReport, error)
+}
+
+// Compact rewrites the file to the latest version of each record, dropping
+// superseded versions and records expired at now, except the one with the
+// largest UUID, which keeps the UUID sequence monotonic across restarts. The
+// live records are written to a temp file while redirects and writes continue;
+// writes appended meanwhile are copied over under the write lock right before
+// the temp file atomically replaces the storage file. Compactions run one at a
+// time.
+func (storage *FileStorage) Compact(now time.Time) (CompactReport, error) {
+	var report CompactReport
+	if storage.readOnly {
+		return report, ErrReadOnly
+	}
+	storage.compactMu.Lock()
+	defer storage.compactMu.Unlock()
+	storage.mu.RLock()
+	rows, err := storage.readRows()
+	if err == nil {
+		report.Lines, err = storage.countLines()
+	}
+	snapshot, statErr := storage.file.Stat()
+	storage.mu.RUnlock()
+	if err != nil {
+		return report, err
+	}
+	if statErr != nil {
+		return report, statErr
+	}
+	offset := snapshot.Size()
+
+	temp, err := os.CreateTemp(filepath.Dir(storage.filename), filepath.Base(storage.filename)+".compact-*")
+	if err != nil {
+		return report, err
+	}
+	// the temp file is removed unless it replaced the storage file
+	defer os.Remove(temp.Name())
+	for i := range rows {
+		// the record with the largest UUID is kept so the counter is restored past it
+		if rows[i].Expired(now) && i != len(rows)-1 {
+			report.Expired++
+			continue
+		}
+		if err := encodeRow(temp, &rows[i], storage.checksums || rows[i].CRC != 0); err != nil {
+			temp.Close()
+			return report, err
+		}
+		report.Records++
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	// the lines appended since the snapshot are only copied from the same file
+	current, err := storage.file.Stat()
+	if err != nil {
+		temp.Close()
+		return report, err
+	}
+	if !os.SameFile(snapshot, current) || current.Size() < offset {
+		temp.Close()
+		return report, errors.New("file storage changed during compaction")
+	}
+	_, err = io.Copy(temp, io.NewSectionReader(storage.file, offset, current.Size()-offset))
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return report, err
+	}
+	if err := os.Rename(temp.Name(), storage.filename); err != nil {
+		return report, err
+	}
+	// persist the rename itself
+	if err := syncDir(filepath.Dir(storage.filename)); err != nil {
+		return report, err
+	}
+	file, err := os.OpenFile(storage.filename, os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return report, err
+	}
+	storage.file.Close()
+	storage.file = file
+	if err := storage.rebuildIndex(); err != nil {
+		return report, err
+	}
+	log.Infof("File storage compacted: %s; lines=%d; records=%d; expired=%d",
+		storage.filename, report.Lines, report.Records, report.Expired)
+	return report, nil
+}
+
+// countLines counts the valid record lines of the file
+func (storage *FileStorage) countLines() (int, error) {
+	lines := 0
+	err := storage.scan(func(row DataRow) {
+		lines++
+	})
+	return lines, err
+}
+
+// syncDir flushes the directory entries to disk
+func syncDir(name string) error {
+	dir, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
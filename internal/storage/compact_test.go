@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Compact(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	expired := time.Now().Add(-time.Hour)
+	storage.AddURL("short1", "http://example1.com")
+	storage.AddRow(DataRow{ShortURL: "short2", OriginalURL: "http://example2.com", ExpiresAt: &expired})
+	storage.AddURL("short3", "http://example3.com")
+	row, _, _ := storage.GetRow("short1")
+	row.OriginalURL = "http://example1.org"
+	storage.UpdateRow(row)
+
+	report, err := storage.Compact(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, CompactReport{Lines: 4, Records: 2, Expired: 1}, report)
+
+	data, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+
+	// the storage keeps working on the new file
+	require.NoError(t, storage.AddURL("short4", "http://example4.com"))
+	url, ok, err := storage.GetURL("short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example1.org", url)
+	_, ok, _ = storage.GetURL("short2")
+	assert.False(t, ok)
+
+	require.NoError(t, storage.Close())
+	reopened, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+	assert.Equal(t, int64(4), reopened.counter)
+}
+
+func TestFileStorage_CompactKeepsLastUUID(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	expired := time.Now().Add(-time.Hour)
+	storage.AddURL("short1", "http://example1.com")
+	storage.AddRow(DataRow{ShortURL: "short2", OriginalURL: "http://example2.com", ExpiresAt: &expired})
+
+	report, err := storage.Compact(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Expired)
+
+	require.NoError(t, storage.Close())
+	reopened, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), reopened.counter)
+}
+
+func TestFileStorage_CompactConcurrentReads(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		storage.AddURL("short"+strings.Repeat("x", i), "http://example.com")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			_, err := storage.Compact(time.Now())
+			assert.NoError(t, err)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			_, ok, err := storage.GetURL("short")
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+	}
+}
+
+func TestFileStorage_CompactConcurrent(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	defer storage.Close()
+	for i := 0; i < 1000; i++ {
+		require.NoError(t, storage.AddURL(fmt.Sprintf("old%d", i), "http://example.com"))
+	}
+	// superseded versions make the compacted file shorter than the snapshots
+	for i := 0; i < 1000; i++ {
+		row, _, err := storage.GetRow(fmt.Sprintf("old%d", i))
+		require.NoError(t, err)
+		row.OriginalURL = "http://example.org"
+		require.NoError(t, storage.UpdateRow(row))
+	}
+
+	// two compactions race with writes, no record is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := storage.Compact(time.Now())
+			assert.NoError(t, err)
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, storage.AddURL(fmt.Sprintf("new%d", i), "http://example.com"))
+		}(i)
+	}
+	wg.Wait()
+
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 1200)
+	reopened, err := NewFileStorage(file.Name(), WithReadOnly())
+	require.NoError(t, err)
+	defer reopened.Close()
+	all, err = reopened.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 1200)
+}
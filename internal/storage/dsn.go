@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/kv"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// opener creates a storage from the location part of a DSN
+type opener func(location string) (Storage, error)
+
+// backends storage openers by DSN scheme
+var backends = map[string]opener{
+	"file":   openFileStorage,
+	"memory": openMemoryStorage,
+	"kv":     openKVStorage,
+}
+
+// openFileStorage opens a file storage from
+// path?sync=policy&sync_interval=duration&crc=bool&readonly=bool&follow=duration
+func openFileStorage(location string) (Storage, error) {
+	path, query, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	options, err := fileOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	if value := query.Get("readonly"); value != "" {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid readonly: %s", value)
+		}
+		if readOnly {
+			options = append(options, WithReadOnly())
+		}
+	}
+	if value := query.Get("follow"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid follow: %s", value)
+		}
+		options = append(options, WithFollow(interval))
+	}
+	return NewFileStorage(path, options...)
+}
+
+// openMemoryStorage opens a memory storage from
+// dir?snapshot_interval=duration&sync=policy&sync_interval=duration&crc=bool
+func openMemoryStorage(location string) (Storage, error) {
+	dir, query, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	options, err := fileOptions(query)
+	if err != nil {
+		return nil, err
+	}
+	interval := DefaultSnapshotInterval
+	if value := query.Get("snapshot_interval"); value != "" {
+		if interval, err = time.ParseDuration(value); err != nil || interval < 0 {
+			return nil, fmt.Errorf("invalid snapshot_interval: %s", value)
+		}
+	}
+	return NewMemoryStorage(dir, interval, options...)
+}
+
+// openKVStorage opens a key-value storage from path?nosync=bool
+func openKVStorage(location string) (Storage, error) {
+	path, query, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	options := &kv.Options{}
+	if value := query.Get("nosync"); value != "" {
+		if options.NoSync, err = strconv.ParseBool(value); err != nil {
+			return nil, fmt.Errorf("invalid nosync: %s", value)
+		}
+	}
+	return NewKVStorage(path, options)
+}
+
+// parseLocation splits a location into the path and the query parameters
+func parseLocation(location string) (string, url.Values, error) {
+	path, rawQuery, _ := strings.Cut(location, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid storage parameters: %v", err)
+	}
+	return path, query, nil
+}
+
+// fileOptions parses the sync=policy&sync_interval=duration&crc=bool parameters of file writes
+func fileOptions(query url.Values) ([]FileOption, error) {
+	var options []FileOption
+	if value := query.Get("sync"); value != "" {
+		policy, err := ParseSyncPolicy(value)
+		if err != nil {
+			return nil, err
+		}
+		interval := time.Second
+		if value := query.Get("sync_interval"); value != "" {
+			if interval, err = time.ParseDuration(value); err != nil || interval <= 0 {
+				return nil, fmt.Errorf("invalid sync_interval: %s", value)
+			}
+		}
+		options = append(options, WithSyncPolicy(policy, interval))
+	}
+	if value := query.Get("crc"); value != "" {
+		checksums, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid crc: %s", value)
+		}
+		if checksums {
+			options = append(options, WithChecksums())
+		}
+	}
+	return options, nil
+}
+
+// ParseDSN splits a storage DSN of the form scheme:location, a leading // of
+// the location is dropped so both file:/tmp/storage.txt and file:///tmp/storage.txt work
+func ParseDSN(dsn string) (string, string, error) {
+	scheme, location, ok := strings.Cut(dsn, ":")
+	if !ok || scheme == "" {
+		return "", "", fmt.Errorf("invalid storage DSN, expected scheme:location: %s", dsn)
+	}
+	location = strings.TrimPrefix(location, "//")
+	if location == "" {
+		return "", "", fmt.Errorf("invalid storage DSN, empty location: %s", dsn)
+	}
+	return scheme, location, nil
+}
+
+// Open creates the storage described by the DSN
+func Open(dsn string) (Storage, error) {
+	scheme, location, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	open, ok := backends[scheme]
+	if !ok {
+		names := make([]string, 0, len(backends))
+		for name := range backends {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unsupported storage backend %q, available: %s", scheme, strings.Join(names, ", "))
+	}
+	return open(location)
+}
+
+// OpenReadOnly creates the storage described by the DSN for reading only, so a
+// file storage used by a running server can be read without taking its lock
+func OpenReadOnly(dsn string) (Storage, error) {
+	scheme, location, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if scheme != "file" {
+		return Open(dsn)
+	}
+	separator := "?"
+	if strings.Contains(location, "?") {
+		separator = "&"
+	}
+	return openFileStorage(location + separator + "readonly=true")
+}
@@ -0,0 +1,23 @@
+package storage
+
+import "sync"
+
+// editMu serializes EditRow, the storage files are locked to a single process
+// so edits do not interleave across processes
+var editMu sync.Mutex
+
+// EditRow reads the record, changes it with fn and stores the new version.
+// Edits are serialized, so the changes and history entries of concurrent
+// edits of a record are not lost. An error of fn aborts the edit.
+func EditRow(s Storage, hash string, fn func(row *DataRow) error) (DataRow, bool, error) {
+	editMu.Lock()
+	defer editMu.Unlock()
+	row, ok, err := s.GetRow(hash)
+	if err != nil || !ok {
+		return row, ok, err
+	}
+	if err := fn(&row); err != nil {
+		return row, true, err
+	}
+	return row, true, s.UpdateRow(row)
+}
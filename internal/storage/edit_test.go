@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEditRow tests that concurrent edits keep every history entry
+func TestEditRow(t *testing.T) {
+	s := NewShardedMap(4)
+	require.NoError(t, s.AddURL("edited", "https://example.com/0"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok, err := EditRow(s, "edited", func(row *DataRow) error {
+				row.History = append(row.History, DataRowEdit{EditedAt: time.Now(), OriginalURL: row.OriginalURL})
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}()
+	}
+	wg.Wait()
+
+	row, _, err := s.GetRow("edited")
+	require.NoError(t, err)
+	assert.Len(t, row.History, 50)
+
+	_, ok, err := EditRow(s, "missing", func(row *DataRow) error { return nil })
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrUnknownKey is returned for a record encrypted with a key missing from the keyring
+var ErrUnknownKey = errors.New("unknown encryption key")
+
+// ErrEncryptedRow is returned for a record written through EncryptedStorage with
+// a key ID, the records read from it are decrypted, so the key ID is not its own
+var ErrEncryptedRow = errors.New("record is already encrypted")
+
+// Keyring AES-GCM keys by ID, new records are encrypted with the active key
+type Keyring struct {
+	active string
+	aeads  map[string]cipher.AEAD
+}
+
+// ParseKeyring parses keys given as id:base64key separated by commas, the first
+// key is active and the others are kept to decrypt older records. Keys are 16,
+// 24 or 32 bytes long for AES-128, AES-192 or AES-256.
+func ParseKeyring(spec string) (*Keyring, error) {
+	keys := &Keyring{aeads: make(map[string]cipher.AEAD)}
+	for i, entry := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok || id == "" {
+			// the entry itself is not printed, it may be a key
+			return nil, fmt.Errorf("invalid encryption key #%d, expected id:base64key", i+1)
+		}
+		if _, ok := keys.aeads[id]; ok {
+			return nil, fmt.Errorf("duplicate encryption key ID: %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %v", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %s: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		keys.aeads[id] = aead
+		if keys.active == "" {
+			keys.active = id
+		}
+	}
+	return keys, nil
+}
+
+// Active returns the ID of the key used for new records
+func (keys *Keyring) Active() string {
+	return keys.active
+}
+
+// seal encrypts the value with the active key, the short URL is authenticated
+// with it, so a value cannot be moved to another record
+func (keys *Keyring) seal(value, hash string) (string, error) {
+	aead := keys.aeads[keys.active]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(hash))
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value sealed with the key
+func (keys *Keyring) open(keyID, value, hash string) (string, error) {
+	aead, ok := keys.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(value)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("invalid encrypted URL of %s", hash)
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(hash))
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt URL of %s: %v", hash, err)
+	}
+	return string(plain), nil
+}
+
+// encryptRow returns the record with its URLs encrypted by the active key,
+// a record that is already encrypted is returned as is
+func (keys *Keyring) encryptRow(row DataRow) (DataRow, error) {
+	if row.KeyID != "" {
+		return row, fmt.Errorf("%w: %s", ErrEncryptedRow, row.ShortURL)
+	}
+	var err error
+	if row.OriginalURL, err = keys.seal(row.OriginalURL, row.ShortURL); err != nil {
+		return row, err
+	}
+	history := make([]DataRowEdit, len(row.History))
+	for i, edit := range row.History {
+		if edit.OriginalURL, err = keys.seal(edit.OriginalURL, row.ShortURL); err != nil {
+			return row, err
+		}
+		history[i] = edit
+	}
+	if row.History != nil {
+		row.History = history
+	}
+	row.KeyID = keys.active
+	return row, nil
+}
+
+// decryptRow returns the record with its URLs in plain text
+func (keys *Keyring) decryptRow(row DataRow) (DataRow, error) {
+	if row.KeyID == "" {
+		return row, nil
+	}
+	var err error
+	if row.OriginalURL, err = keys.open(row.KeyID, row.OriginalURL, row.ShortURL); err != nil {
+		return row, err
+	}
+	history := make([]DataRowEdit, len(row.History))
+	for i, edit := range row.History {
+		if edit.OriginalURL, err = keys.open(row.KeyID, edit.OriginalURL, row.ShortURL); err != nil {
+			return row, err
+		}
+		history[i] = edit
+	}
+	if row.History != nil {
+		row.History = history
+	}
+	// the CRC of the stored line covers the ciphertext
+	row.KeyID = ""
+	row.CRC = 0
+	return row, nil
+}
+
+// EncryptedStorage encrypts the target URLs of records before they reach the
+// wrapped storage and decrypts them on read. Records written before encryption
+// was enabled are read as they are.
+type EncryptedStorage struct {
+	Storage
+	keys *Keyring
+}
+
+// NewEncryptedStorage wraps the storage with encryption by the keyring
+func NewEncryptedStorage(s Storage, keys *Keyring) *EncryptedStorage {
+	return &EncryptedStorage{Storage: s, keys: keys}
+}
+
+// AddURL encrypts and adds a URL
+func (e *EncryptedStorage) AddURL(hash, url string) error {
+	return e.AddRow(DataRow{ShortURL: hash, OriginalURL: url})
+}
+
+// AddRow encrypts and adds a record
+func (e *EncryptedStorage) AddRow(row DataRow) error {
+	row, err := e.keys.encryptRow(row)
+	if err != nil {
+		return err
+	}
+	return e.Storage.AddRow(row)
+}
+
+// UpdateRow encrypts and updates a record
+func (e *EncryptedStorage) UpdateRow(row DataRow) error {
+	row, err := e.keys.encryptRow(row)
+	if err != nil {
+		return err
+	}
+	return e.Storage.UpdateRow(row)
+}
+
+// GetURL retrieves and decrypts a URL
+func (e *EncryptedStorage) GetURL(hash string) (string, bool, error) {
+	row, ok, err := e.GetRow(hash)
+	return row.OriginalURL, ok, err
+}
+
+// GetRow retrieves and decrypts a record
+func (e *EncryptedStorage) GetRow(hash string) (DataRow, bool, error) {
+	row, ok, err := e.Storage.GetRow(hash)
+	if err != nil || !ok {
+		return row, ok, err
+	}
+	row, err = e.keys.decryptRow(row)
+	if err != nil {
+		return DataRow{}, false, err
+	}
+	return row, true, nil
+}
+
+// GetAll retrieves a copy of all decrypted URLs
+func (e *EncryptedStorage) GetAll() (map[string]string, error) {
+	mCopy := make(map[string]string)
+	err := e.Range(0, false, func(row DataRow) bool {
+		mCopy[row.ShortURL] = row.OriginalURL
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mCopy, nil
+}
+
+// Range calls fn for each decrypted record, a record that cannot be decrypted stops the iteration
+func (e *EncryptedStorage) Range(cursor int64, desc bool, fn func(row DataRow) bool) error {
+	var decryptErr error
+	err := e.Storage.Range(cursor, desc, func(row DataRow) bool {
+		if row, decryptErr = e.keys.decryptRow(row); decryptErr != nil {
+			return false
+		}
+		return fn(row)
+	})
+	if err != nil {
+		return err
+	}
+	return decryptErr
+}
+
+// Unwrap returns the wrapped storage
+func (e *EncryptedStorage) Unwrap() Storage {
+	return e.Storage
+}
+
+// Close closes the wrapped storage
+func (e *EncryptedStorage) Close() error {
+	if closer, ok := e.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// ReencryptReport result of a re-encryption
+type ReencryptReport struct {
+	Records     int
+	Reencrypted int
+}
+
+// Reencrypt encrypts every record of the storage that is in plain text or
+// encrypted with another key with the active key of the keyring. Storages
+// appending new versions keep the old ones until they are compacted.
+func Reencrypt(s Storage, keys *Keyring) (ReencryptReport, error) {
+	var report ReencryptReport
+	var updateErr error
+	err := s.Range(0, false, func(row DataRow) bool {
+		report.Records++
+		if row.KeyID == keys.active {
+			return true
+		}
+		if row, updateErr = keys.decryptRow(row); updateErr != nil {
+			return false
+		}
+		if row, updateErr = keys.encryptRow(row); updateErr != nil {
+			return false
+		}
+		if updateErr = s.UpdateRow(row); updateErr != nil {
+			return false
+		}
+		report.Reencrypted++
+		return true
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, updateErr
+}
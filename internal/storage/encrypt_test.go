@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKey returns a base64 AES-256 key filled with the byte
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(b), 32)))
+}
+
+func TestParseKeyring(t *testing.T) {
+	keys, err := ParseKeyring("new:" + testKey('n') + ", old:" + testKey('o'))
+	require.NoError(t, err)
+	assert.Equal(t, "new", keys.Active())
+	assert.Len(t, keys.aeads, 2)
+
+	for _, spec := range []string{
+		"",
+		testKey('k'),
+		":" + testKey('k'),
+		"k:not-base64",
+		"k:" + base64.StdEncoding.EncodeToString([]byte("short")),
+		"k:" + testKey('a') + ",k:" + testKey('b'),
+	} {
+		_, err := ParseKeyring(spec)
+		assert.Error(t, err, spec)
+	}
+	// a malformed entry is not echoed, it may be a key
+	_, err = ParseKeyring(testKey('k'))
+	assert.NotContains(t, err.Error(), testKey('k'))
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+	backend, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	defer backend.Close()
+
+	// a record written before encryption was enabled stays readable
+	require.NoError(t, backend.AddURL("plain", "http://plain.com"))
+	oldKeys, err := ParseKeyring("old:" + testKey('o'))
+	require.NoError(t, err)
+	encrypted := NewEncryptedStorage(backend, oldKeys)
+	require.NoError(t, encrypted.AddURL("short1", "http://example1.com"))
+	row, _, err := encrypted.GetRow("short1")
+	require.NoError(t, err)
+	row.History = append(row.History, DataRowEdit{OriginalURL: row.OriginalURL})
+	row.OriginalURL = "http://example1.org"
+	require.NoError(t, encrypted.UpdateRow(row))
+
+	url, ok, err := encrypted.GetURL("short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example1.org", url)
+	row, _, err = encrypted.GetRow("short1")
+	require.NoError(t, err)
+	assert.Empty(t, row.KeyID)
+	assert.Equal(t, "http://example1.com", row.History[0].OriginalURL)
+	all, err := encrypted.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"plain": "http://plain.com", "short1": "http://example1.org"}, all)
+	_, ok, err = encrypted.GetURL("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// the storage keeps only ciphertext
+	raw, _, err := backend.GetRow("short1")
+	require.NoError(t, err)
+	assert.Equal(t, "old", raw.KeyID)
+	assert.NotContains(t, raw.OriginalURL, "example1")
+	assert.NotContains(t, raw.History[0].OriginalURL, "example1")
+	data, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "example1")
+
+	// a record claiming a key ID is rejected instead of being stored in plain text
+	assert.ErrorIs(t, encrypted.AddRow(DataRow{ShortURL: "claimed", OriginalURL: "http://claimed.com", KeyID: "old"}), ErrEncryptedRow)
+	_, ok, err = backend.GetRow("claimed")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// a value moved to another record does not decrypt
+	raw.ShortURL = "short2"
+	raw.UUID = 0
+	require.NoError(t, backend.AddRow(raw))
+	_, _, err = encrypted.GetRow("short2")
+	assert.Error(t, err)
+	require.NoError(t, backend.UpdateRow(DataRow{UUID: 3, ShortURL: "short2", OriginalURL: "http://example2.com"}))
+
+	// without the old key the records cannot be read
+	newKeys, err := ParseKeyring("new:" + testKey('n'))
+	require.NoError(t, err)
+	_, _, err = NewEncryptedStorage(backend, newKeys).GetRow("short1")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	// after a rotation all records are moved to the new key
+	rotated, err := ParseKeyring("new:" + testKey('n') + ",old:" + testKey('o'))
+	require.NoError(t, err)
+	report, err := Reencrypt(backend, rotated)
+	require.NoError(t, err)
+	assert.Equal(t, ReencryptReport{Records: 3, Reencrypted: 3}, report)
+	report, err = Reencrypt(backend, rotated)
+	require.NoError(t, err)
+	assert.Equal(t, ReencryptReport{Records: 3, Reencrypted: 0}, report)
+	all, err = NewEncryptedStorage(backend, newKeys).GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"plain":  "http://plain.com",
+		"short1": "http://example1.org",
+		"short2": "http://example2.com",
+	}, all)
+	assert.Same(t, backend, Unwrap(encrypted))
+}
@@ -1,11 +1,17 @@
 package storage
 
 import (
-	"encoding/json"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"io"
 	"os"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Line struct to store single URL
@@ -13,52 +19,212 @@ type DataRow struct {
 	UUID        int64  `json:"uuid"`
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	// CreatedAt time the record was added, nil for records written before it existed
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// RedirectCode overrides the global redirect status code, 0 means default
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// Passthrough appends the incoming query string and suffix path on redirect
+	Passthrough bool `json:"passthrough,omitempty"`
+	// ExpiresAt time after which the link is no longer redirected
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Title optional human readable title
+	Title string `json:"title,omitempty"`
+	// Tags optional labels used to organize and filter links
+	Tags []string `json:"tags,omitempty"`
+	// Notes optional free-text notes
+	Notes string `json:"notes,omitempty"`
+	// History previous versions of the editable fields, oldest first
+	History []DataRowEdit `json:"history,omitempty"`
+	// KeyID encryption key of OriginalURL and the history URLs, empty if they are stored in plain text
+	KeyID string `json:"key_id,omitempty"`
+	// CRC optional CRC-32 of the line encoded without it, 0 means no checksum
+	CRC uint32 `json:"crc,omitempty"`
+}
+
+// DataRowEdit struct to store the values replaced by a single edit
+type DataRowEdit struct {
+	EditedAt     time.Time  `json:"edited_at"`
+	OriginalURL  string     `json:"original_url"`
+	RedirectCode int        `json:"redirect_code,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Notes        string     `json:"notes,omitempty"`
+}
+
+// Expired reports whether the link has expired at the given time
+func (row *DataRow) Expired(now time.Time) bool {
+	return row.ExpiresAt != nil && !now.Before(*row.ExpiresAt)
+}
+
+// HasTag reports whether the record is labeled with the tag
+func (row *DataRow) HasTag(tag string) bool {
+	for _, t := range row.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // FileStorage struct to store all URLs
 type FileStorage struct {
-	mu      sync.RWMutex
-	file    *os.File
-	counter int64
+	mu       sync.RWMutex
+	file     *os.File
+	filename string
+	counter  int64
+	sync     *syncer
+	// checksums adds a CRC to every written line
+	checksums bool
+	// lock holds the advisory lock of a writable storage, nil for read-only followers
+	lock *os.File
+	// readOnly rejects writes, the file is owned by another process
+	readOnly bool
+	// follow indexes the file in memory and polls it for new lines, nil if not following
+	follow *follower
+	// index orders the latest versions of the records for Range
+	index *rowIndex
+	// end offset of the next line written by a writable storage
+	end int64
+	// compactMu serializes compactions
+	compactMu sync.Mutex
+	// appendFile appends to the file instead of its Write method, set by tests to inject failures
+	appendFile func(b []byte) (int, error)
+}
+
+// ErrLocked is returned when the storage file is used by another process
+var ErrLocked = errors.New("file storage is locked by another process")
+
+// ErrReadOnly is returned on writes to a read-only storage
+var ErrReadOnly = errors.New("file storage is read-only")
+
+// ReadOnlyStorage is implemented by storages that can be opened read-only
+type ReadOnlyStorage interface {
+	// ReadOnly reports whether writes are rejected with ErrReadOnly
+	ReadOnly() bool
+}
+
+// IsReadOnly reports whether the storage below the decorators rejects writes,
+// e.g. a follower of the file written by the primary
+func IsReadOnly(s Storage) bool {
+	readOnly, ok := Unwrap(s).(ReadOnlyStorage)
+	return ok && readOnly.ReadOnly()
+}
+
+// ReadOnly reports whether the storage was opened read-only
+func (storage *FileStorage) ReadOnly() bool {
+	return storage.readOnly
 }
 
 // AddURL adds a URL
 func (storage *FileStorage) AddURL(hash, url string) error {
+	return storage.AddRow(DataRow{ShortURL: hash, OriginalURL: url})
+}
+
+// AddRow adds a record, a zero UUID is assigned by the storage,
+// otherwise the UUID is kept and the counter is moved past it
+func (storage *FileStorage) AddRow(row DataRow) error {
+	if storage.readOnly {
+		return ErrReadOnly
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if row.UUID == 0 {
+		row.UUID = atomic.AddInt64(&storage.counter, 1)
+	} else if row.UUID > atomic.LoadInt64(&storage.counter) {
+		atomic.StoreInt64(&storage.counter, row.UUID)
+	}
+	if row.CreatedAt == nil {
+		now := time.Now().UTC()
+		row.CreatedAt = &now
+	}
+	return storage.write(&row)
+}
+
+// UpdateRow appends a new version of an existing record keeping its UUID
+func (storage *FileStorage) UpdateRow(row DataRow) error {
+	if row.UUID == 0 {
+		return errors.New("cannot update a row without UUID")
+	}
+	if storage.readOnly {
+		return ErrReadOnly
+	}
 	storage.mu.Lock()
 	defer storage.mu.Unlock()
-	uuid := atomic.AddInt64(&storage.counter, 1)
-	row := &DataRow{
-		UUID:        uuid,
-		ShortURL:    hash,
-		OriginalURL: url,
-	}
-	encoder := json.NewEncoder(storage.file)
-	if err := encoder.Encode(row); err != nil {
+	return storage.write(&row)
+}
+
+// write appends a record as a single line and syncs it according to the sync policy,
+// the caller holds the write lock
+func (storage *FileStorage) write(row *DataRow) error {
+	var line bytes.Buffer
+	if err := encodeRow(&line, row, storage.checksums); err != nil {
 		return err
 	}
-	return nil
+	offset := storage.end
+	appendFile := storage.file.Write
+	if storage.appendFile != nil {
+		appendFile = storage.appendFile
+	}
+	n, err := appendFile(line.Bytes())
+	if err != nil {
+		if n > 0 {
+			storage.cutTornLine(offset, n)
+		}
+		return err
+	}
+	storage.end += int64(n)
+	storage.index.add(*row, offset)
+	return storage.sync.written(storage.file)
+}
+
+// cutTornLine removes the n bytes of a failed write at the offset, so the next
+// record does not continue the torn line. If the file cannot be truncated, the
+// torn line is ended instead and is skipped by the readers like a corrupted line.
+func (storage *FileStorage) cutTornLine(offset int64, n int) {
+	err := storage.file.Truncate(offset)
+	if err == nil {
+		return
+	}
+	log.Error(err)
+	storage.end += int64(n)
+	if _, err := storage.file.Write([]byte("\n")); err != nil {
+		log.Error(err)
+		return
+	}
+	storage.end++
 }
 
 // GetURL retrieves a URL
 func (storage *FileStorage) GetURL(hash string) (string, bool, error) {
+	row, ok, err := storage.GetRow(hash)
+	return row.OriginalURL, ok, err
+}
+
+// GetRow retrieves a record
+func (storage *FileStorage) GetRow(hash string) (DataRow, bool, error) {
 	storage.mu.RLock()
 	defer storage.mu.RUnlock()
-
-	// Reset file pointer to beginning
-	storage.file.Seek(0, 0)
-	decoder := json.NewDecoder(storage.file)
-
-	// while the array contains values
-	for decoder.More() {
-		var row DataRow
-		if err := decoder.Decode(&row); err != nil {
-			return "", false, err
-		}
-		if row.ShortURL == hash {
-			return row.OriginalURL, true, nil
-		}
+	if storage.follow != nil {
+		row, ok := storage.follow.rows[hash]
+		return row, ok, nil
 	}
-	return "", false, nil
+	// the index points to the line of the latest version
+	entry, ok := storage.index.lookup(hash)
+	if !ok {
+		return DataRow{}, false, nil
+	}
+	line, err := storage.readLine(entry.offset)
+	if err != nil {
+		return DataRow{}, false, err
+	}
+	row, err := decodeRow(line)
+	if err != nil {
+		// a line changed behind the storage is skipped like on startup
+		log.Infof("Skipping corrupted line of file storage at offset %d: %v", entry.offset, err)
+		return DataRow{}, false, nil
+	}
+	return row, true, nil
 }
 
 // GetAll retrieves a copy of all URLs
@@ -67,47 +233,271 @@ func (storage *FileStorage) GetAll() (map[string]string, error) {
 	defer storage.mu.RUnlock()
 	// Return a copy to avoid exposing internal state
 	mCopy := make(map[string]string, 0)
-
-	// Reset file pointer to beginning
-	storage.file.Seek(0, 0)
-	decoder := json.NewDecoder(storage.file)
-
-	// while the array contains values
-	for decoder.More() {
-		var line DataRow
-		if err := decoder.Decode(&line); err != nil {
-			return nil, err
+	if storage.follow != nil {
+		for hash, row := range storage.follow.rows {
+			mCopy[hash] = row.OriginalURL
 		}
+		return mCopy, nil
+	}
+	err := storage.scan(func(line DataRow) {
 		mCopy[line.ShortURL] = line.OriginalURL
+	})
+	if err != nil {
+		return nil, err
 	}
 	return mCopy, nil
 }
 
-// restoreCounter restores the counter from the file
-func (storage *FileStorage) restoreCounter() {
-	storage.file.Seek(0, 0)
-	decoder := json.NewDecoder(storage.file)
+// Range calls fn for the latest version of each record in UUID order until fn
+// returns false. Ascending order starts after the cursor UUID, descending order
+// starts before it; a zero cursor starts from the first or the last record.
+// The lines are read from the index in pages, fn is called without holding the
+// lock, so it may write to the storage.
+func (storage *FileStorage) Range(cursor int64, desc bool, fn func(row DataRow) bool) error {
+	for {
+		rows, err := storage.readPage(cursor, desc)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if !fn(row) {
+				return nil
+			}
+			cursor = row.UUID
+		}
+		if len(rows) < rangeBatch {
+			return nil
+		}
+	}
+}
+
+// rangeRows calls fn for the rows ordered by UUID from the cursor until fn returns false
+func rangeRows(rows []DataRow, cursor int64, desc bool, fn func(row DataRow) bool) {
+	if desc {
+		for i := len(rows) - 1; i >= 0; i-- {
+			if cursor != 0 && rows[i].UUID >= cursor {
+				continue
+			}
+			if !fn(rows[i]) {
+				return
+			}
+		}
+		return
+	}
+	for _, row := range rows {
+		if row.UUID <= cursor {
+			continue
+		}
+		if !fn(row) {
+			return
+		}
+	}
+}
+
+// readRows reads the latest version of all records ordered by UUID
+func (storage *FileStorage) readRows() ([]DataRow, error) {
+	rows := make([]DataRow, 0)
+	index := make(map[string]int)
+	err := storage.scan(func(row DataRow) {
+		if i, ok := index[row.ShortURL]; ok {
+			rows[i] = row
+			return
+		}
+		index[row.ShortURL] = len(rows)
+		rows = append(rows, row)
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].UUID < rows[j].UUID
+	})
+	return rows, nil
+}
+
+// scan calls fn for every valid record line of the file in file order,
+// corrupted lines and lines with a wrong CRC are skipped, they are reported by
+// the startup recovery
+func (storage *FileStorage) scan(fn func(row DataRow)) error {
+	reader, _, err := storage.reader()
+	if err != nil {
+		return err
+	}
+	return scanLines(reader, func(line []byte, _ int64) {
+		if row, err := decodeRow(line); err == nil {
+			fn(row)
+		}
+	})
+}
+
+// scanLines calls fn with every line of the reader without the line break and
+// the offset of the line start; a last line without line break is passed too
+func scanLines(reader io.Reader, fn func(line []byte, offset int64)) error {
+	buffered := bufio.NewReader(reader)
+	var offset int64
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			fn(bytes.TrimSuffix(line, []byte("\n")), offset)
+		}
+		offset += int64(len(line))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// reader returns a reader of the current file content and its size. Reads do not
+// move the shared file offset, so concurrent readers do not interfere.
+func (storage *FileStorage) reader() (io.Reader, int64, error) {
+	info, err := storage.file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NewSectionReader(storage.file, 0, info.Size()), info.Size(), nil
+}
 
-	var lastRow DataRow
-	for decoder.More() {
-		if err := decoder.Decode(&lastRow); err != nil {
-			break
+// recoverFile checks the file after a possible crash, restores the counter and
+// indexes the records. A final line without line break that does not decode is
+// a torn write and is cut off; corrupted complete lines are logged and skipped
+// by the readers.
+func (storage *FileStorage) recoverFile() error {
+	storage.index = newRowIndex()
+	reader, _, err := storage.reader()
+	if err != nil {
+		return err
+	}
+	buffered := bufio.NewReader(reader)
+	var offset int64
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if err == io.EOF {
+			if err := storage.recoverLastLine(line, offset); err != nil {
+				return err
+			}
+			_, storage.end, err = storage.reader()
+			return err
 		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			row, err := decodeRow(line)
+			if err != nil {
+				log.Infof("Skipping corrupted line of file storage at offset %d: %v", offset, err)
+			} else {
+				// edits keep the UUID of the record, so the last line is not always the latest UUID
+				storage.counter = max(storage.counter, row.UUID)
+				storage.index.add(row, offset)
+			}
+		}
+		offset += int64(len(line))
 	}
-	storage.counter = lastRow.UUID
 }
 
-// NewFileStorage creates a new thread-safe file storage
-func NewFileStorage(filename string) (*FileStorage, error) {
+// recoverLastLine handles the final line without line break starting at offset
+func (storage *FileStorage) recoverLastLine(line []byte, offset int64) error {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+	if row, err := decodeRow(line); err == nil {
+		// a complete record without line break is kept
+		storage.counter = max(storage.counter, row.UUID)
+		storage.index.add(row, offset)
+		log.Infof("Adding missing line break at the end of file storage: %s", storage.filename)
+		_, err = storage.file.Write([]byte("\n"))
+		return err
+	}
+	log.Infof("Truncating torn last line of file storage at offset %d: %s", offset, storage.filename)
+	if err := storage.file.Truncate(offset); err != nil {
+		return err
+	}
+	return storage.file.Sync()
+}
+
+// Close stops the background sync, syncs and closes the file and releases the lock
+func (storage *FileStorage) Close() error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.sync.stop()
+	storage.follow.stop()
+	var err error
+	if !storage.readOnly {
+		err = storage.file.Sync()
+	}
+	if closeErr := storage.file.Close(); err == nil {
+		err = closeErr
+	}
+	if storage.lock != nil {
+		unlockFile(storage.lock)
+		storage.lock.Close()
+	}
+	return err
+}
+
+// NewFileStorage creates a new thread-safe file storage, by default the file is
+// never synced explicitly. The file is guarded by an advisory lock on a .lock
+// file next to it, so a second process fails with ErrLocked unless it opens the
+// storage read-only.
+func NewFileStorage(filename string, options ...FileOption) (*FileStorage, error) {
 	log.Infof("Creating file storage: %s", filename)
+	storage := &FileStorage{
+		filename: filename,
+		counter:  0,
+	}
+	for _, option := range options {
+		option(storage)
+	}
+	if storage.readOnly {
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		storage.file = file
+		if storage.follow != nil {
+			storage.resetFollow()
+			if err := storage.catchUp(); err != nil {
+				file.Close()
+				return nil, err
+			}
+			storage.follow.start(storage)
+			return storage, nil
+		}
+		// the file is owned by the primary, a torn last line may still be written;
+		// records appended after the file was opened are not indexed
+		if err := storage.rebuildIndex(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return storage, nil
+	}
+
+	lock, err := os.OpenFile(filename+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w: %s (open it read-only to follow it)", err, filename)
+		}
+		return nil, err
+	}
+	storage.lock = lock
 	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
+		unlockFile(lock)
+		lock.Close()
 		return nil, err
 	}
-	storage := &FileStorage{
-		file:    file,
-		counter: 0,
+	storage.file = file
+	if err := storage.recoverFile(); err != nil {
+		storage.Close()
+		return nil, err
 	}
-	storage.restoreCounter()
+	storage.sync.start(storage)
 	return storage, nil
 }
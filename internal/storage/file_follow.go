@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"io"
+	"os"
+	"time"
+)
+
+// follower keeps an in-memory index of a file written by another process and
+// polls the file for appended lines
+type follower struct {
+	interval time.Duration
+	// rows latest version of every record by short URL
+	rows map[string]DataRow
+	// offset end of the last complete line read into the index
+	offset int64
+	done   chan struct{}
+}
+
+// reset drops the index, the file is read again from the start
+func (f *follower) reset() {
+	f.rows = make(map[string]DataRow)
+	f.offset = 0
+}
+
+// resetFollow drops the records of a follower, the file is read again from the start
+func (storage *FileStorage) resetFollow() {
+	storage.follow.reset()
+	storage.index = newRowIndex()
+	storage.counter = 0
+}
+
+// start polls the file in the background until stop
+func (f *follower) start(storage *FileStorage) {
+	done := make(chan struct{})
+	f.done = done
+	go func() {
+		ticker := time.NewTicker(f.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := storage.poll(); err != nil {
+					log.Error(err)
+				}
+			}
+		}
+	}()
+}
+
+// stop ends the polling
+func (f *follower) stop() {
+	if f == nil || f.done == nil {
+		return
+	}
+	close(f.done)
+	f.done = nil
+}
+
+// poll reopens the file when the primary has replaced it, e.g. by a compaction,
+// and reads the lines appended since the last poll
+func (storage *FileStorage) poll() error {
+	info, err := os.Stat(storage.filename)
+	if err != nil {
+		return err
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if storage.follow.done == nil {
+		// closed while waiting for the lock
+		return nil
+	}
+	current, err := storage.file.Stat()
+	if err != nil {
+		return err
+	}
+	if !os.SameFile(info, current) {
+		log.Infof("File storage was replaced, reloading: %s", storage.filename)
+		file, err := os.Open(storage.filename)
+		if err != nil {
+			return err
+		}
+		storage.file.Close()
+		storage.file = file
+		storage.resetFollow()
+	}
+	return storage.catchUp()
+}
+
+// catchUp reads the complete lines appended after the indexed offset into the
+// index, a last line without line break may still be written by the primary and
+// is read on the next poll. The caller holds the write lock.
+func (storage *FileStorage) catchUp() error {
+	info, err := storage.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < storage.follow.offset {
+		log.Infof("File storage was truncated, reloading: %s", storage.filename)
+		storage.resetFollow()
+	}
+	if info.Size() == storage.follow.offset {
+		return nil
+	}
+	reader := io.NewSectionReader(storage.file, storage.follow.offset, info.Size()-storage.follow.offset)
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			row, err := decodeRow(line)
+			if err != nil {
+				log.Infof("Skipping corrupted line of file storage at offset %d: %v", storage.follow.offset, err)
+			} else {
+				storage.follow.rows[row.ShortURL] = row
+				storage.index.add(row, storage.follow.offset)
+				storage.counter = max(storage.counter, row.UUID)
+			}
+		}
+		storage.follow.offset += int64(len(line))
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// followedURL returns a condition that holds once the follower has indexed the hash
+func followedURL(t *testing.T, follower *FileStorage, hash string) func() bool {
+	return func() bool {
+		_, ok, err := follower.GetURL(hash)
+		require.NoError(t, err)
+		return ok
+	}
+}
+
+func TestFileStorage_Follow(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	primary, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	defer primary.Close()
+	require.NoError(t, primary.AddURL("short1", "http://example1.com"))
+
+	opened, err := Open("file:" + file.Name() + "?follow=10ms")
+	require.NoError(t, err)
+	follower := opened.(*FileStorage)
+	defer follower.Close()
+
+	// existing lines are indexed on open
+	url, ok, err := follower.GetURL("short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example1.com", url)
+	assert.ErrorIs(t, follower.AddURL("short2", "http://example2.com"), ErrReadOnly)
+	assert.True(t, IsReadOnly(NewCachedStorage(follower, 10, 0)))
+	assert.False(t, IsReadOnly(primary))
+
+	// appended lines and edits show up after a poll
+	require.NoError(t, primary.AddURL("short2", "http://example2.com"))
+	assert.Eventually(t, followedURL(t, follower, "short2"), time.Second, 10*time.Millisecond)
+	row, _, err := primary.GetRow("short1")
+	require.NoError(t, err)
+	row.OriginalURL = "http://example1.org"
+	require.NoError(t, primary.UpdateRow(row))
+	assert.Eventually(t, func() bool {
+		url, _, err := follower.GetURL("short1")
+		require.NoError(t, err)
+		return url == "http://example1.org"
+	}, time.Second, 10*time.Millisecond)
+
+	var uuids []int64
+	require.NoError(t, follower.Range(0, false, func(row DataRow) bool {
+		uuids = append(uuids, row.UUID)
+		return true
+	}))
+	assert.Equal(t, []int64{1, 2}, uuids)
+
+	// the follower reopens the file replaced by a compaction
+	_, err = primary.Compact(time.Now())
+	require.NoError(t, err)
+	require.NoError(t, primary.AddURL("short3", "http://example3.com"))
+	assert.Eventually(t, followedURL(t, follower, "short3"), time.Second, 10*time.Millisecond)
+	all, err := follower.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"short1": "http://example1.org",
+		"short2": "http://example2.com",
+		"short3": "http://example3.com",
+	}, all)
+}
+
+func TestFileStorage_FollowPartialLine(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	follower, err := NewFileStorage(file.Name(), WithFollow(10*time.Millisecond))
+	require.NoError(t, err)
+	defer follower.Close()
+
+	// a line still being written by the primary is not indexed
+	_, err = file.WriteString(`{"uuid":1,"short_url":"short1",`)
+	require.NoError(t, err)
+	require.NoError(t, follower.poll())
+	_, ok, err := follower.GetURL("short1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = file.WriteString(`"original_url":"http://example1.com"}` + "\n")
+	require.NoError(t, err)
+	assert.Eventually(t, followedURL(t, follower, "short1"), time.Second, 10*time.Millisecond)
+	require.NoError(t, file.Close())
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sort"
+)
+
+// indexEntry line of the latest version of a record
+type indexEntry struct {
+	uuid   int64
+	hash   string
+	offset int64
+}
+
+// rowIndex orders the latest versions of the records by UUID and keeps the
+// offsets of their lines, so Range reads a page of lines instead of the file
+type rowIndex struct {
+	// uuids UUIDs of the latest versions in ascending order
+	uuids []int64
+	// entries line of the latest version by UUID
+	entries map[int64]indexEntry
+	// hashes UUID of the latest version by short URL
+	hashes map[string]int64
+}
+
+// newRowIndex creates an empty index
+func newRowIndex() *rowIndex {
+	return &rowIndex{entries: make(map[int64]indexEntry), hashes: make(map[string]int64)}
+}
+
+// add records the line of a record at the offset, replacing its previous version
+func (index *rowIndex) add(row DataRow, offset int64) {
+	if previous, ok := index.hashes[row.ShortURL]; ok && previous != row.UUID {
+		// a record replacing a short URL takes its place in the UUID order
+		index.remove(previous)
+	}
+	if entry, ok := index.entries[row.UUID]; !ok {
+		index.insert(row.UUID)
+	} else if entry.hash != row.ShortURL {
+		delete(index.hashes, entry.hash)
+	}
+	index.entries[row.UUID] = indexEntry{uuid: row.UUID, hash: row.ShortURL, offset: offset}
+	index.hashes[row.ShortURL] = row.UUID
+}
+
+// lookup returns the line of the latest version of the record with the short URL
+func (index *rowIndex) lookup(hash string) (indexEntry, bool) {
+	uuid, ok := index.hashes[hash]
+	if !ok {
+		return indexEntry{}, false
+	}
+	return index.entries[uuid], true
+}
+
+// insert adds the UUID to the ordered UUIDs, new records are usually the last
+func (index *rowIndex) insert(uuid int64) {
+	n := len(index.uuids)
+	if n == 0 || index.uuids[n-1] < uuid {
+		index.uuids = append(index.uuids, uuid)
+		return
+	}
+	i := sort.Search(n, func(i int) bool { return index.uuids[i] >= uuid })
+	index.uuids = append(index.uuids, 0)
+	copy(index.uuids[i+1:], index.uuids[i:])
+	index.uuids[i] = uuid
+}
+
+// remove drops the record with the UUID
+func (index *rowIndex) remove(uuid int64) {
+	i := sort.Search(len(index.uuids), func(i int) bool { return index.uuids[i] >= uuid })
+	if i < len(index.uuids) && index.uuids[i] == uuid {
+		index.uuids = append(index.uuids[:i], index.uuids[i+1:]...)
+	}
+	delete(index.hashes, index.entries[uuid].hash)
+	delete(index.entries, uuid)
+}
+
+// page returns up to limit entries after (or before, if desc) the cursor UUID
+// in the order of the iteration, a zero cursor starts from the first or the last
+func (index *rowIndex) page(cursor int64, desc bool, limit int) []indexEntry {
+	n := len(index.uuids)
+	var uuids []int64
+	if desc {
+		end := n
+		if cursor != 0 {
+			end = sort.Search(n, func(i int) bool { return index.uuids[i] >= cursor })
+		}
+		uuids = index.uuids[max(end-limit, 0):end]
+	} else {
+		start := sort.Search(n, func(i int) bool { return index.uuids[i] > cursor })
+		uuids = index.uuids[start:min(start+limit, n)]
+	}
+	entries := make([]indexEntry, len(uuids))
+	for i, uuid := range uuids {
+		if desc {
+			i = len(uuids) - 1 - i
+		}
+		entries[i] = index.entries[uuid]
+	}
+	return entries
+}
+
+// readPage reads up to rangeBatch records after (or before, if desc) the cursor
+// UUID, see Range
+func (storage *FileStorage) readPage(cursor int64, desc bool) ([]DataRow, error) {
+	storage.mu.RLock()
+	defer storage.mu.RUnlock()
+	entries := storage.index.page(cursor, desc, rangeBatch)
+	rows := make([]DataRow, 0, len(entries))
+	for _, entry := range entries {
+		if storage.follow != nil {
+			// the file of a follower may have been replaced since it was indexed
+			rows = append(rows, storage.follow.rows[entry.hash])
+			continue
+		}
+		row, err := storage.readRow(entry.offset)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readRow reads the record of the line starting at the offset
+func (storage *FileStorage) readRow(offset int64) (DataRow, error) {
+	line, err := storage.readLine(offset)
+	if err != nil {
+		return DataRow{}, err
+	}
+	return decodeRow(line)
+}
+
+// readLine reads the line starting at the offset without the line break
+func (storage *FileStorage) readLine(offset int64) ([]byte, error) {
+	buf := make([]byte, 512)
+	for {
+		n, err := storage.file.ReadAt(buf, offset)
+		if i := bytes.IndexByte(buf[:n], '\n'); i >= 0 {
+			return buf[:i], nil
+		}
+		if err == io.EOF {
+			return buf[:n], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// rebuildIndex indexes the valid lines of the file, the caller holds the write lock
+func (storage *FileStorage) rebuildIndex() error {
+	storage.index = newRowIndex()
+	reader, size, err := storage.reader()
+	if err != nil {
+		return err
+	}
+	storage.end = size
+	return scanLines(reader, func(line []byte, offset int64) {
+		if row, err := decodeRow(line); err == nil {
+			storage.index.add(row, offset)
+			storage.counter = max(storage.counter, row.UUID)
+		}
+	})
+}
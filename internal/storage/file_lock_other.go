@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package storage
+
+import (
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"os"
+)
+
+// lockFile is not supported on this platform, the storage is not protected
+func lockFile(file *os.File) error {
+	log.Infof("File locking is not supported on this platform: %s", file.Name())
+	return nil
+}
+
+// unlockFile is not supported on this platform
+func unlockFile(file *os.File) error {
+	return nil
+}
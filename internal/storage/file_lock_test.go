@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Lock(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	require.NoError(t, storage.AddURL("short1", "http://example1.com"))
+
+	// a second writer fails fast
+	_, err = NewFileStorage(file.Name())
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// a read-only follower shares the file
+	follower, err := OpenReadOnly("file:" + file.Name())
+	require.NoError(t, err)
+	url, ok, err := follower.GetURL("short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example1.com", url)
+	assert.ErrorIs(t, follower.AddURL("short2", "http://example2.com"), ErrReadOnly)
+	require.NoError(t, follower.(*FileStorage).Close())
+
+	// the lock is released on close
+	require.NoError(t, storage.Close())
+	reopened, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	require.NoError(t, reopened.Close())
+}
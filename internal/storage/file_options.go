@@ -0,0 +1,37 @@
+package storage
+
+import "time"
+
+// FileOption configures a FileStorage
+type FileOption func(storage *FileStorage)
+
+// WithSyncPolicy sets the fsync policy of the file storage, the interval is used by SyncInterval
+func WithSyncPolicy(policy SyncPolicy, interval time.Duration) FileOption {
+	return func(storage *FileStorage) {
+		storage.sync = &syncer{policy: policy, interval: interval}
+	}
+}
+
+// WithReadOnly opens the storage read-only without taking the lock,
+// so it can follow a file written by another process
+func WithReadOnly() FileOption {
+	return func(storage *FileStorage) {
+		storage.readOnly = true
+	}
+}
+
+// WithFollow opens the storage read-only and keeps an in-memory index of the
+// file, the file is polled for lines appended by the primary every interval
+func WithFollow(interval time.Duration) FileOption {
+	return func(storage *FileStorage) {
+		storage.readOnly = true
+		storage.follow = &follower{interval: interval}
+	}
+}
+
+// WithChecksums adds a CRC to every line written by the file storage
+func WithChecksums() FileOption {
+	return func(storage *FileStorage) {
+		storage.checksums = true
+	}
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// SyncPolicy defines when file storage writes are flushed to disk with fsync
+type SyncPolicy string
+
+const (
+	// SyncAlways syncs after every write
+	SyncAlways SyncPolicy = "always"
+	// SyncInterval syncs pending writes periodically
+	SyncInterval SyncPolicy = "interval"
+	// SyncNever leaves flushing to the operating system
+	SyncNever SyncPolicy = "never"
+)
+
+// ParseSyncPolicy parses and validates a sync policy name
+func ParseSyncPolicy(value string) (SyncPolicy, error) {
+	switch policy := SyncPolicy(value); policy {
+	case SyncAlways, SyncInterval, SyncNever:
+		return policy, nil
+	}
+	return "", fmt.Errorf("sync policy must be one of always, interval, never: got %q", value)
+}
+
+// syncer applies the sync policy, a nil syncer never syncs
+type syncer struct {
+	policy   SyncPolicy
+	interval time.Duration
+	dirty    atomic.Bool
+	done     chan struct{}
+}
+
+// written is called after every write under the write lock
+func (s *syncer) written(file *os.File) error {
+	if s == nil {
+		return nil
+	}
+	switch s.policy {
+	case SyncAlways:
+		return file.Sync()
+	case SyncInterval:
+		s.dirty.Store(true)
+	}
+	return nil
+}
+
+// start runs the periodic sync of the interval policy
+func (s *syncer) start(storage *FileStorage) {
+	if s == nil || s.policy != SyncInterval || s.interval <= 0 {
+		return
+	}
+	done := make(chan struct{})
+	s.done = done
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !s.dirty.Swap(false) {
+					continue
+				}
+				// the read lock keeps the file from being swapped by a compaction
+				storage.mu.RLock()
+				err := storage.file.Sync()
+				storage.mu.RUnlock()
+				if err != nil {
+					log.Error(err)
+				}
+			}
+		}
+	}()
+}
+
+// stop ends the periodic sync
+func (s *syncer) stop() {
+	if s == nil || s.done == nil {
+		return
+	}
+	close(s.done)
+	s.done = nil
+}
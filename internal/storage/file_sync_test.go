@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, value := range []string{"always", "interval", "never"} {
+		policy, err := ParseSyncPolicy(value)
+		require.NoError(t, err)
+		assert.Equal(t, SyncPolicy(value), policy)
+	}
+	_, err := ParseSyncPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+func TestFileStorage_SyncPolicies(t *testing.T) {
+	setup()
+	tests := []struct {
+		name string
+		dsn  string
+	}{
+		{name: "Always", dsn: "?sync=always"},
+		{name: "Interval", dsn: "?sync=interval&sync_interval=10ms"},
+		{name: "Never", dsn: "?sync=never"},
+		{name: "Default", dsn: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := os.CreateTemp("", "storage_test.json")
+			require.NoError(t, err)
+			defer os.Remove(file.Name())
+			defer os.Remove(file.Name() + ".lock")
+
+			store, err := Open("file:" + file.Name() + tt.dsn)
+			require.NoError(t, err)
+			storage := store.(*FileStorage)
+			require.NoError(t, storage.AddURL("short1", "http://example.com"))
+			if storage.sync != nil && storage.sync.policy == SyncInterval {
+				assert.Eventually(t, func() bool {
+					return !storage.sync.dirty.Load()
+				}, time.Second, 10*time.Millisecond)
+			}
+			require.NoError(t, storage.Close())
+		})
+	}
+}
+
+func TestOpenInvalidSyncParameters(t *testing.T) {
+	_, err := Open("file:/tmp/storage_test.json?sync=sometimes")
+	assert.Error(t, err)
+	_, err = Open("file:/tmp/storage_test.json?sync=interval&sync_interval=soon")
+	assert.Error(t, err)
+}
+
+func TestFileStorage_RecoverTornLine(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	valid := `{"uuid":1,"short_url":"short1","original_url":"http://example1.com"}` + "\n" +
+		`{"uuid":2,"short_url":"short2","original_url":"http://example2.com"}` + "\n"
+	file.WriteString(valid + `{"uuid":3,"short_url":"sho`)
+	file.Close()
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), storage.counter)
+	data, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, valid, string(data))
+
+	// new records start on a fresh line
+	require.NoError(t, storage.AddURL("short3", "http://example3.com"))
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+func TestFileStorage_ShortWrite(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	require.NoError(t, storage.AddURL("short1", "http://example1.com"))
+	end := storage.end
+
+	// a failed write leaves half of the line in the file
+	storage.appendFile = func(b []byte) (int, error) {
+		n, _ := storage.file.Write(b[:len(b)/2])
+		return n, errors.New("no space left on device")
+	}
+	assert.Error(t, storage.AddURL("short2", "http://example2.com"))
+	storage.appendFile = nil
+	assert.Equal(t, end, storage.end)
+	info, err := os.Stat(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, end, info.Size())
+
+	// the next record does not continue the torn line
+	require.NoError(t, storage.AddURL("short3", "http://example3.com"))
+	require.NoError(t, storage.Close())
+	reopened, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	defer reopened.Close()
+	all, err := reopened.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"short1": "http://example1.com", "short3": "http://example3.com"}, all)
+}
+
+func TestFileStorage_RecoverCorruptedLine(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	content := `{"uuid":1,"short_url":"short1","original_url":"http://example1.com"}` + "\n" +
+		`{"uuid":2,"short_url":` + "\n" +
+		`{"uuid":3,"short_url":"short3","original_url":"http://example3.com"}`
+	file.WriteString(content)
+	file.Close()
+
+	storage, err := NewFileStorage(file.Name())
+	require.NoError(t, err)
+	// the records after the corrupted line are kept and the last one gets its line break
+	assert.Equal(t, int64(3), storage.counter)
+	data, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	assert.Equal(t, content+"\n", string(data))
+
+	url, ok, err := storage.GetURL("short3")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example3.com", url)
+}
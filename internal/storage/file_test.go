@@ -7,6 +7,7 @@ import (
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // setup function to initialize common test data
@@ -23,6 +24,7 @@ func TestFileStorage_AddURL(t *testing.T) {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
 	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
 
 	storage, _ := NewFileStorage(file.Name())
 	storage.AddURL("short1", "http://example.com")
@@ -43,6 +45,7 @@ func TestFileStorage_GetURLNotFound(t *testing.T) {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
 	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
 
 	storage, _ := NewFileStorage(file.Name())
 	_, found, _ := storage.GetURL("nonexistent")
@@ -58,6 +61,7 @@ func TestFileStorage_GetAll(t *testing.T) {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
 	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
 
 	storage, _ := NewFileStorage(file.Name())
 	storage.AddURL("short1", "http://example1.com")
@@ -82,6 +86,7 @@ func TestFileStorage_Concurrency(t *testing.T) {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
 	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
 
 	storage, _ := NewFileStorage(file.Name())
 	var wg sync.WaitGroup
@@ -111,15 +116,199 @@ func TestFileStorage_RestoreCounter(t *testing.T) {
 		t.Fatalf("Failed to create temp file: %v", err)
 	}
 	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
 
 	storage, _ := NewFileStorage(file.Name())
 	storage.AddURL("short1", "http://example1.com")
 	storage.AddURL("short2", "http://example2.com")
 
 	file.Close()
+	storage.Close()
 	newStorage, _ := NewFileStorage(file.Name())
 
 	if atomic.LoadInt64(&newStorage.counter) != 2 {
 		t.Errorf("Expected counter to be restored to 2, got %d", newStorage.counter)
 	}
 }
+
+func TestFileStorage_AddRow(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, _ := NewFileStorage(file.Name())
+	storage.AddRow(DataRow{ShortURL: "short1", OriginalURL: "http://example.com", RedirectCode: 301})
+
+	row, found, _ := storage.GetRow("short1")
+	if !found {
+		t.Fatalf("Expected row not found")
+	}
+	if row.UUID != 1 {
+		t.Errorf("Expected UUID %d, got %d", 1, row.UUID)
+	}
+	if row.RedirectCode != 301 {
+		t.Errorf("Expected redirect code %d, got %d", 301, row.RedirectCode)
+	}
+}
+
+func TestFileStorage_UpdateRow(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, _ := NewFileStorage(file.Name())
+	storage.AddURL("short1", "http://example1.com")
+	storage.AddURL("short2", "http://example2.com")
+	row, _, _ := storage.GetRow("short1")
+	row.OriginalURL = "http://example1.org"
+	if err := storage.UpdateRow(row); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+
+	result, _, _ := storage.GetURL("short1")
+	if result != "http://example1.org" {
+		t.Errorf("Expected %s, got %s", "http://example1.org", result)
+	}
+	allURLs, _ := storage.GetAll()
+	if allURLs["short1"] != "http://example1.org" {
+		t.Errorf("Expected %s, got %s", "http://example1.org", allURLs["short1"])
+	}
+
+	file.Close()
+	storage.Close()
+	newStorage, _ := NewFileStorage(file.Name())
+	if atomic.LoadInt64(&newStorage.counter) != 2 {
+		t.Errorf("Expected counter to be restored to 2, got %d", newStorage.counter)
+	}
+}
+
+func TestFileStorage_Range(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, _ := NewFileStorage(file.Name())
+	storage.AddRow(DataRow{ShortURL: "short1", OriginalURL: "http://example1.com", Tags: []string{"promo"}})
+	storage.AddURL("short2", "http://example2.com")
+	storage.AddURL("short3", "http://example3.com")
+	row, _, _ := storage.GetRow("short1")
+	row.Title = "Example"
+	storage.UpdateRow(row)
+
+	var rows []DataRow
+	storage.Range(0, false, func(row DataRow) bool {
+		rows = append(rows, row)
+		return true
+	})
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+	if rows[0].ShortURL != "short1" || rows[0].Title != "Example" || !rows[0].HasTag("promo") {
+		t.Errorf("Expected latest version of short1 first, got %+v", rows[0])
+	}
+	if rows[0].CreatedAt == nil {
+		t.Errorf("Expected created_at to be set")
+	}
+
+	var hashes []string
+	storage.Range(3, true, func(row DataRow) bool {
+		hashes = append(hashes, row.ShortURL)
+		return len(hashes) < 1
+	})
+	if len(hashes) != 1 || hashes[0] != "short2" {
+		t.Errorf("Expected [short2] before cursor 3, got %v", hashes)
+	}
+
+	hashes = nil
+	storage.Range(1, false, func(row DataRow) bool {
+		hashes = append(hashes, row.ShortURL)
+		return true
+	})
+	if len(hashes) != 2 || hashes[0] != "short2" || hashes[1] != "short3" {
+		t.Errorf("Expected [short2 short3] after cursor 1, got %v", hashes)
+	}
+}
+
+func TestFileStorage_RangePages(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 2*rangeBatch + 10
+	for i := 1; i <= count; i++ {
+		storage.AddURL("short"+strconv.Itoa(i), "http://example"+strconv.Itoa(i)+".com")
+	}
+	// replacing a short URL moves it to the end, an edit keeps its place
+	storage.AddURL("short1", "http://example1.org")
+	row, _, _ := storage.GetRow("short2")
+	row.Title = "Edited"
+	storage.UpdateRow(row)
+
+	collect := func(s *FileStorage, cursor int64, desc bool) []DataRow {
+		var rows []DataRow
+		if err := s.Range(cursor, desc, func(row DataRow) bool {
+			rows = append(rows, row)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return rows
+	}
+	check := func(s *FileStorage) {
+		rows := collect(s, 0, false)
+		if len(rows) != count {
+			t.Fatalf("Expected %d rows, got %d", count, len(rows))
+		}
+		for i := 1; i < len(rows); i++ {
+			if rows[i-1].UUID >= rows[i].UUID {
+				t.Fatalf("Expected ascending UUIDs, got %d before %d", rows[i-1].UUID, rows[i].UUID)
+			}
+		}
+		if rows[0].ShortURL != "short2" || rows[0].Title != "Edited" {
+			t.Errorf("Expected edited short2 first, got %+v", rows[0])
+		}
+		if last := rows[len(rows)-1]; last.ShortURL != "short1" || last.OriginalURL != "http://example1.org" {
+			t.Errorf("Expected replaced short1 last, got %+v", last)
+		}
+		desc := collect(s, rows[len(rows)-1].UUID, true)
+		if len(desc) != count-1 || desc[0].UUID != rows[len(rows)-2].UUID {
+			t.Errorf("Expected %d rows before the last one, got %d", count-1, len(desc))
+		}
+	}
+	check(storage)
+
+	// the index is rebuilt after a compaction and on open
+	if _, err := storage.Compact(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	storage.AddURL("short1", "http://example1.net")
+	storage.AddURL("short1", "http://example1.org")
+	check(storage)
+	storage.Close()
+	reopened, err := NewFileStorage(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check(reopened)
+}
@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/kv"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// buckets of the key-value storage
+const (
+	// linksBucket short URL to the JSON of its record
+	linksBucket = "links"
+	// uuidsBucket big-endian UUID to short URL, orders Range
+	uuidsBucket = "uuids"
+)
+
+// rangeBatch number of records read at a time by Range
+const rangeBatch = 256
+
+// BatchWriter is implemented by storages that add many records in one transaction
+type BatchWriter interface {
+	// AddRows adds all records or none of them
+	AddRows(rows []DataRow) error
+}
+
+// KVStorage stores records in an embedded B+tree key-value file
+type KVStorage struct {
+	db      *kv.DB
+	lock    *os.File
+	counter int64
+}
+
+// NewKVStorage opens the key-value file, guarded by an advisory lock on a
+// .lock file next to it like FileStorage
+func NewKVStorage(filename string, options *kv.Options) (*KVStorage, error) {
+	log.Infof("Creating key-value storage: %s", filename)
+	lock, err := os.OpenFile(filename+".lock", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock); err != nil {
+		lock.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%w: %s", err, filename)
+		}
+		return nil, err
+	}
+	storage := &KVStorage{lock: lock}
+	if storage.db, err = kv.Open(filename, options); err != nil {
+		storage.Close()
+		return nil, err
+	}
+	err = storage.db.Update(func(tx *kv.Tx) error {
+		for _, name := range []string{linksBucket, uuidsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		key, _, err := tx.Bucket(uuidsBucket).Cursor().Last()
+		if key != nil {
+			storage.counter = int64(binary.BigEndian.Uint64(key))
+		}
+		return err
+	})
+	if err != nil {
+		storage.Close()
+		return nil, err
+	}
+	return storage, nil
+}
+
+// uuidKey encodes the UUID so the keys sort in UUID order
+func uuidKey(uuid int64) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(uuid))
+}
+
+// AddURL adds a URL
+func (storage *KVStorage) AddURL(hash, url string) error {
+	return storage.AddRow(DataRow{ShortURL: hash, OriginalURL: url})
+}
+
+// AddRow adds a record, a zero UUID is assigned by the storage,
+// otherwise the UUID is kept and the counter is moved past it
+func (storage *KVStorage) AddRow(row DataRow) error {
+	return storage.AddRows([]DataRow{row})
+}
+
+// AddRows adds the records in one transaction. A record replacing a short URL
+// takes its place in the UUID order like a new line of FileStorage.
+func (storage *KVStorage) AddRows(rows []DataRow) error {
+	return storage.db.Update(func(tx *kv.Tx) error {
+		links, uuids := tx.Bucket(linksBucket), tx.Bucket(uuidsBucket)
+		for _, row := range rows {
+			if row.UUID == 0 {
+				row.UUID = atomic.AddInt64(&storage.counter, 1)
+			} else if row.UUID > atomic.LoadInt64(&storage.counter) {
+				atomic.StoreInt64(&storage.counter, row.UUID)
+			}
+			if row.CreatedAt == nil {
+				now := time.Now().UTC()
+				row.CreatedAt = &now
+			}
+			previous, ok, err := getRow(links, row.ShortURL)
+			if err != nil {
+				return err
+			}
+			if ok && previous.UUID != row.UUID {
+				if err := uuids.Delete(uuidKey(previous.UUID)); err != nil {
+					return err
+				}
+			}
+			if err := putRow(links, row); err != nil {
+				return err
+			}
+			if err := uuids.Put(uuidKey(row.UUID), []byte(row.ShortURL)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateRow stores a new version of an existing record keeping its UUID
+func (storage *KVStorage) UpdateRow(row DataRow) error {
+	if row.UUID == 0 {
+		return errors.New("cannot update a row without UUID")
+	}
+	return storage.db.Update(func(tx *kv.Tx) error {
+		return putRow(tx.Bucket(linksBucket), row)
+	})
+}
+
+// putRow stores the record under its short URL
+func putRow(links *kv.Bucket, row DataRow) error {
+	value, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	return links.Put([]byte(row.ShortURL), value)
+}
+
+// getRow reads the record of the short URL
+func getRow(links *kv.Bucket, hash string) (DataRow, bool, error) {
+	value, err := links.Get([]byte(hash))
+	if err != nil || value == nil {
+		return DataRow{}, false, err
+	}
+	var row DataRow
+	if err := json.Unmarshal(value, &row); err != nil {
+		return DataRow{}, false, err
+	}
+	return row, true, nil
+}
+
+// GetURL retrieves a URL
+func (storage *KVStorage) GetURL(hash string) (string, bool, error) {
+	row, ok, err := storage.GetRow(hash)
+	return row.OriginalURL, ok, err
+}
+
+// GetRow retrieves a record
+func (storage *KVStorage) GetRow(hash string) (DataRow, bool, error) {
+	var row DataRow
+	var ok bool
+	err := storage.db.View(func(tx *kv.Tx) error {
+		var err error
+		row, ok, err = getRow(tx.Bucket(linksBucket), hash)
+		return err
+	})
+	return row, ok, err
+}
+
+// GetAll retrieves a copy of all URLs
+func (storage *KVStorage) GetAll() (map[string]string, error) {
+	mCopy := make(map[string]string)
+	err := storage.db.View(func(tx *kv.Tx) error {
+		cursor := tx.Bucket(linksBucket).Cursor()
+		key, value, err := cursor.First()
+		for ; err == nil && key != nil; key, value, err = cursor.Next() {
+			var row DataRow
+			if err := json.Unmarshal(value, &row); err != nil {
+				return err
+			}
+			mCopy[string(key)] = row.OriginalURL
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mCopy, nil
+}
+
+// Range calls fn for each record in UUID order until fn returns false, see
+// FileStorage.Range. Records are read in batches, fn is called outside of the
+// transactions, so it may write to the storage.
+func (storage *KVStorage) Range(cursor int64, desc bool, fn func(row DataRow) bool) error {
+	for {
+		rows, err := storage.readBatch(cursor, desc)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if !fn(row) {
+				return nil
+			}
+			cursor = row.UUID
+		}
+		if len(rows) < rangeBatch {
+			return nil
+		}
+	}
+}
+
+// readBatch reads up to rangeBatch records after (or before, if desc) the cursor UUID
+func (storage *KVStorage) readBatch(cursor int64, desc bool) ([]DataRow, error) {
+	rows := make([]DataRow, 0, rangeBatch)
+	err := storage.db.View(func(tx *kv.Tx) error {
+		links, uuids := tx.Bucket(linksBucket), tx.Bucket(uuidsBucket).Cursor()
+		var key, value []byte
+		var err error
+		switch {
+		case !desc:
+			key, value, err = uuids.Seek(uuidKey(cursor + 1))
+		case cursor == 0:
+			key, value, err = uuids.Last()
+		default:
+			if key, _, err = uuids.Seek(uuidKey(cursor)); err == nil && key == nil {
+				key, value, err = uuids.Last()
+			} else if err == nil {
+				key, value, err = uuids.Prev()
+			}
+		}
+		for ; err == nil && key != nil && len(rows) < rangeBatch; key, value, err = nextKey(uuids, desc) {
+			row, ok, err := getRow(links, string(value))
+			if err != nil {
+				return err
+			}
+			if ok {
+				rows = append(rows, row)
+			}
+		}
+		return err
+	})
+	return rows, err
+}
+
+// nextKey moves the cursor in the direction of the iteration
+func nextKey(cursor *kv.Cursor, desc bool) ([]byte, []byte, error) {
+	if desc {
+		return cursor.Prev()
+	}
+	return cursor.Next()
+}
+
+// Compact rewrites the file to the live records, expired records are kept
+func (storage *KVStorage) Compact(now time.Time) (CompactReport, error) {
+	var report CompactReport
+	before := storage.db.Size()
+	if err := storage.db.Compact(); err != nil {
+		return report, err
+	}
+	err := storage.Range(0, false, func(row DataRow) bool {
+		report.Records++
+		return true
+	})
+	log.Infof("Key-value storage compacted: size %d -> %d bytes; records=%d", before, storage.db.Size(), report.Records)
+	return report, err
+}
+
+// Close closes the file and releases the lock
+func (storage *KVStorage) Close() error {
+	var err error
+	if storage.db != nil {
+		err = storage.db.Close()
+	}
+	unlockFile(storage.lock)
+	storage.lock.Close()
+	return err
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rangeUUIDs returns the UUIDs visited by Range
+func rangeUUIDs(t *testing.T, s Storage, cursor int64, desc bool, limit int) []int64 {
+	uuids := make([]int64, 0)
+	require.NoError(t, s.Range(cursor, desc, func(row DataRow) bool {
+		uuids = append(uuids, row.UUID)
+		return len(uuids) < limit
+	}))
+	return uuids
+}
+
+func TestKVStorage(t *testing.T) {
+	setup()
+	path := filepath.Join(t.TempDir(), "storage.db")
+	opened, err := Open("kv:" + path + "?nosync=true")
+	require.NoError(t, err)
+	storage := opened.(*KVStorage)
+
+	require.NoError(t, storage.AddURL("short1", "http://example1.com"))
+	require.NoError(t, storage.AddRow(DataRow{ShortURL: "short2", OriginalURL: "http://example2.com", Tags: []string{"a"}}))
+	row, ok, err := storage.GetRow("short2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(2), row.UUID)
+	assert.Equal(t, []string{"a"}, row.Tags)
+	assert.NotNil(t, row.CreatedAt)
+
+	row.OriginalURL = "http://example2.org"
+	require.NoError(t, storage.UpdateRow(row))
+	assert.Error(t, storage.UpdateRow(DataRow{ShortURL: "short3"}))
+	// adding an existing short URL moves it to the end of the UUID order
+	require.NoError(t, storage.AddURL("short1", "http://example1.org"))
+	assert.Equal(t, []int64{2, 3}, rangeUUIDs(t, storage, 0, false, 10))
+
+	_, ok, err = storage.GetURL("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// a second process fails fast
+	_, err = NewKVStorage(path, nil)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	// the data and the counter survive a reopen
+	require.NoError(t, storage.Close())
+	storage, err = NewKVStorage(path, nil)
+	require.NoError(t, err)
+	defer storage.Close()
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"short1": "http://example1.org", "short2": "http://example2.org"}, all)
+	require.NoError(t, storage.AddURL("short4", "http://example4.com"))
+	row, _, err = storage.GetRow("short4")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), row.UUID)
+}
+
+func TestKVStorage_BatchRange(t *testing.T) {
+	setup()
+	dir := t.TempDir()
+	from, err := NewFileStorage(filepath.Join(dir, "from.txt"))
+	require.NoError(t, err)
+	defer from.Close()
+	for i := 1; i <= 1200; i++ {
+		require.NoError(t, from.AddURL(fmt.Sprintf("short%d", i), fmt.Sprintf("http://example%d.com", i)))
+	}
+
+	to, err := NewKVStorage(filepath.Join(dir, "to.db"), nil)
+	require.NoError(t, err)
+	defer to.Close()
+	report, err := Migrate(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, MigrateReport{Copied: 1200, SourceCount: 1200, TargetCount: 1200}, report)
+
+	// Range crosses the read batches in both directions
+	uuids := rangeUUIDs(t, to, 250, false, 1000)
+	assert.Len(t, uuids, 950)
+	assert.Equal(t, int64(251), uuids[0])
+	assert.Equal(t, int64(1200), uuids[949])
+	uuids = rangeUUIDs(t, to, 0, true, 1000)
+	assert.Len(t, uuids, 1000)
+	assert.Equal(t, int64(1200), uuids[0])
+	assert.Equal(t, int64(201), uuids[999])
+	assert.Equal(t, []int64{599, 598}, rangeUUIDs(t, to, 600, true, 2))
+
+	// compaction keeps all records
+	compacted, err := to.Compact(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1200, compacted.Records)
+	url, ok, err := to.GetURL("short1000")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example1000.com", url)
+}
@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultSnapshotInterval period of the memory storage snapshots
+const DefaultSnapshotInterval = 5 * time.Minute
+
+// ErrClosed is returned by a storage used after Close
+var ErrClosed = errors.New("storage is closed")
+
+// MemoryStorage serves all reads from memory and persists writes to an
+// append-only log. A snapshot of all records periodically replaces the log, so a
+// restart loads the last snapshot and replays only the log written after it.
+//
+// The directory holds snapshot-N.jsonl and log-N.jsonl files; snapshot N has
+// all records written before log N was started. Both use the FileStorage line format.
+type MemoryStorage struct {
+	memory *ShardedMap
+	dir    string
+	// options of the log files
+	options []FileOption
+	// mu serializes writes and the log switch of a snapshot
+	mu         sync.Mutex
+	log        *FileStorage
+	generation int64
+	// dirty is set by writes since the last snapshot
+	dirty atomic.Bool
+	// snapshotMu allows one snapshot at a time
+	snapshotMu sync.Mutex
+	closed     bool
+	done       chan struct{}
+}
+
+// NewMemoryStorage loads the storage kept in dir and snapshots it every
+// interval, 0 only snapshots on Close. The options apply to the log files.
+func NewMemoryStorage(dir string, interval time.Duration, options ...FileOption) (*MemoryStorage, error) {
+	log.Infof("Creating memory storage: %s", dir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	storage := &MemoryStorage{
+		memory:  NewShardedMap(0),
+		dir:     dir,
+		options: options,
+	}
+	snapshots, logs, err := storage.generations()
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) > 0 {
+		storage.generation = snapshots[len(snapshots)-1]
+		if err := storage.loadSnapshot(storage.generation); err != nil {
+			return nil, err
+		}
+	}
+	// logs started after the snapshot are replayed in order, the last one is continued
+	replay := make([]int64, 0)
+	for _, generation := range logs {
+		if generation >= storage.generation {
+			replay = append(replay, generation)
+		}
+	}
+	if len(replay) == 0 {
+		replay = append(replay, storage.generation)
+	}
+	for i, generation := range replay {
+		logFile, err := storage.replayLog(generation)
+		if err != nil {
+			return nil, err
+		}
+		if i < len(replay)-1 {
+			logFile.Close()
+			continue
+		}
+		storage.log = logFile
+		storage.generation = generation
+	}
+	storage.removeBefore(replay[0])
+	if interval > 0 {
+		storage.start(interval)
+	}
+	return storage, nil
+}
+
+// snapshotPath returns the name of the snapshot file of the generation
+func (storage *MemoryStorage) snapshotPath(generation int64) string {
+	return filepath.Join(storage.dir, fmt.Sprintf("snapshot-%d.jsonl", generation))
+}
+
+// logPath returns the name of the log file of the generation
+func (storage *MemoryStorage) logPath(generation int64) string {
+	return filepath.Join(storage.dir, fmt.Sprintf("log-%d.jsonl", generation))
+}
+
+// generations lists the generations of the snapshot and log files in ascending order
+func (storage *MemoryStorage) generations() ([]int64, []int64, error) {
+	entries, err := os.ReadDir(storage.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshots, logs := make([]int64, 0), make([]int64, 0)
+	for _, entry := range entries {
+		if generation, ok := parseGeneration(entry.Name(), "snapshot-"); ok {
+			snapshots = append(snapshots, generation)
+		}
+		if generation, ok := parseGeneration(entry.Name(), "log-"); ok {
+			logs = append(logs, generation)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+	sort.Slice(logs, func(i, j int) bool { return logs[i] < logs[j] })
+	return snapshots, logs, nil
+}
+
+// parseGeneration parses the generation of a prefix-N.jsonl file name
+func parseGeneration(name, prefix string) (int64, bool) {
+	value, ok := strings.CutPrefix(name, prefix)
+	if !ok {
+		return 0, false
+	}
+	value, ok = strings.CutSuffix(value, ".jsonl")
+	if !ok {
+		return 0, false
+	}
+	generation, err := strconv.ParseInt(value, 10, 64)
+	return generation, err == nil
+}
+
+// loadSnapshot reads all records of the snapshot into memory, a snapshot is
+// renamed into place complete, so any damaged line is an error
+func (storage *MemoryStorage) loadSnapshot(generation int64) error {
+	name := storage.snapshotPath(generation)
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var decodeErr error
+	count := 0
+	err = scanLines(file, func(line []byte, offset int64) {
+		row, err := decodeRow(line)
+		if err != nil {
+			if decodeErr == nil {
+				decodeErr = fmt.Errorf("corrupted snapshot %s at offset %d: %v", name, offset, err)
+			}
+			return
+		}
+		storage.memory.put(row)
+		storage.memory.movePast(row.UUID)
+		count++
+	})
+	if err != nil {
+		return err
+	}
+	log.Infof("Loaded %d records from snapshot: %s", count, name)
+	return decodeErr
+}
+
+// replayLog opens the log of the generation and applies its records to memory
+func (storage *MemoryStorage) replayLog(generation int64) (*FileStorage, error) {
+	logFile, err := NewFileStorage(storage.logPath(generation), storage.options...)
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	err = logFile.scan(func(row DataRow) {
+		storage.memory.put(row)
+		storage.memory.movePast(row.UUID)
+		count++
+	})
+	if err != nil {
+		logFile.Close()
+		return nil, err
+	}
+	if count > 0 {
+		// the next snapshot makes the replay unnecessary
+		storage.dirty.Store(true)
+	}
+	log.Infof("Replayed %d log records: %s", count, logFile.filename)
+	return logFile, nil
+}
+
+// removeBefore deletes the snapshot and log files older than the generation
+func (storage *MemoryStorage) removeBefore(generation int64) {
+	snapshots, logs, err := storage.generations()
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	for _, old := range snapshots {
+		if old < generation {
+			os.Remove(storage.snapshotPath(old))
+		}
+	}
+	for _, old := range logs {
+		if old < generation {
+			os.Remove(storage.logPath(old))
+			os.Remove(storage.logPath(old) + ".lock")
+		}
+	}
+}
+
+// AddURL adds a URL
+func (storage *MemoryStorage) AddURL(hash, url string) error {
+	return storage.AddRow(DataRow{ShortURL: hash, OriginalURL: url})
+}
+
+// AddRow logs and adds a record, a zero UUID is assigned by the storage,
+// otherwise the UUID is kept and the counter is moved past it
+func (storage *MemoryStorage) AddRow(row DataRow) error {
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if storage.closed {
+		return ErrClosed
+	}
+	if row.UUID == 0 {
+		row.UUID = atomic.AddInt64(&storage.memory.counter, 1)
+	} else {
+		storage.memory.movePast(row.UUID)
+	}
+	if row.CreatedAt == nil {
+		now := time.Now().UTC()
+		row.CreatedAt = &now
+	}
+	if err := storage.log.AddRow(row); err != nil {
+		return err
+	}
+	storage.memory.put(row)
+	storage.dirty.Store(true)
+	return nil
+}
+
+// UpdateRow logs and stores a new version of an existing record
+func (storage *MemoryStorage) UpdateRow(row DataRow) error {
+	if row.UUID == 0 {
+		return errors.New("cannot update a row without UUID")
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if storage.closed {
+		return ErrClosed
+	}
+	if err := storage.log.UpdateRow(row); err != nil {
+		return err
+	}
+	storage.memory.put(row)
+	storage.dirty.Store(true)
+	return nil
+}
+
+// GetURL retrieves a URL
+func (storage *MemoryStorage) GetURL(hash string) (string, bool, error) {
+	return storage.memory.GetURL(hash)
+}
+
+// GetRow retrieves a record
+func (storage *MemoryStorage) GetRow(hash string) (DataRow, bool, error) {
+	return storage.memory.GetRow(hash)
+}
+
+// GetAll retrieves a copy of all URLs
+func (storage *MemoryStorage) GetAll() (map[string]string, error) {
+	return storage.memory.GetAll()
+}
+
+// Range calls fn for each record in UUID order until fn returns false, see FileStorage.Range
+func (storage *MemoryStorage) Range(cursor int64, desc bool, fn func(row DataRow) bool) error {
+	return storage.memory.Range(cursor, desc, fn)
+}
+
+// Snapshot writes all records to a new snapshot and drops the log written before it
+func (storage *MemoryStorage) Snapshot() error {
+	storage.snapshotMu.Lock()
+	defer storage.snapshotMu.Unlock()
+	if storage.closed {
+		return ErrClosed
+	}
+	return storage.snapshot()
+}
+
+// snapshot switches writes to a new log and writes the records logged before
+// it to the snapshot of the same generation, the caller holds snapshotMu
+func (storage *MemoryStorage) snapshot() error {
+	storage.mu.Lock()
+	next := storage.generation + 1
+	logFile, err := NewFileStorage(storage.logPath(next), storage.options...)
+	if err != nil {
+		storage.mu.Unlock()
+		return err
+	}
+	previous := storage.log
+	storage.log = logFile
+	storage.generation = next
+	storage.dirty.Store(false)
+	rows := make([]DataRow, 0)
+	storage.memory.Range(0, false, func(row DataRow) bool {
+		rows = append(rows, row)
+		return true
+	})
+	storage.mu.Unlock()
+	if err := previous.Close(); err != nil {
+		log.Error(err)
+	}
+
+	// until the snapshot is renamed into place the previous logs are replayed on start
+	temp, err := os.CreateTemp(storage.dir, "snapshot-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	for i := range rows {
+		if err = encodeRow(temp, &rows[i], rows[i].CRC != 0); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), storage.snapshotPath(next)); err != nil {
+		return err
+	}
+	if err := syncDir(storage.dir); err != nil {
+		return err
+	}
+	storage.removeBefore(next)
+	log.Infof("Memory storage snapshot written: %s; records=%d", storage.snapshotPath(next), len(rows))
+	return nil
+}
+
+// start writes a snapshot every interval if there were writes since the last one
+func (storage *MemoryStorage) start(interval time.Duration) {
+	done := make(chan struct{})
+	storage.done = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !storage.dirty.Load() {
+					continue
+				}
+				if err := storage.Snapshot(); err != nil && !errors.Is(err, ErrClosed) {
+					log.Error(err)
+				}
+			}
+		}
+	}()
+}
+
+// Close writes a final snapshot, so the next start has no log to replay, and closes the log
+func (storage *MemoryStorage) Close() error {
+	storage.snapshotMu.Lock()
+	defer storage.snapshotMu.Unlock()
+	if storage.closed {
+		return nil
+	}
+	if storage.done != nil {
+		close(storage.done)
+	}
+	var err error
+	if storage.dirty.Load() {
+		err = storage.snapshot()
+	}
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	storage.closed = true
+	if closeErr := storage.log.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dataFiles lists the snapshot and log files of the directory
+func dataFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	require.NoError(t, err)
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, filepath.Base(match))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestMemoryStorage(t *testing.T) {
+	setup()
+	dir := t.TempDir()
+
+	storage, err := NewMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, storage.AddURL("short1", "http://example1.com"))
+	require.NoError(t, storage.AddURL("short2", "http://example2.com"))
+	row, _, err := storage.GetRow("short1")
+	require.NoError(t, err)
+	row.OriginalURL = "http://example1.org"
+	require.NoError(t, storage.UpdateRow(row))
+
+	// a crash leaves only the log, it is replayed on start
+	require.NoError(t, storage.log.Close())
+	storage, err = NewMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	url, ok, err := storage.GetURL("short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "http://example1.org", url)
+	assert.Equal(t, []string{"log-0.jsonl"}, dataFiles(t, dir))
+
+	// a snapshot replaces the log
+	require.NoError(t, storage.Snapshot())
+	assert.Equal(t, []string{"log-1.jsonl", "snapshot-1.jsonl"}, dataFiles(t, dir))
+	require.NoError(t, storage.AddURL("short3", "http://example3.com"))
+
+	// the snapshot is loaded and only the log tail is replayed
+	require.NoError(t, storage.log.Close())
+	storage, err = NewMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"short1": "http://example1.org",
+		"short2": "http://example2.com",
+		"short3": "http://example3.com",
+	}, all)
+	require.NoError(t, storage.AddURL("short4", "http://example4.com"))
+	row, _, err = storage.GetRow("short4")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), row.UUID)
+
+	// close writes a final snapshot
+	require.NoError(t, storage.Close())
+	assert.Equal(t, []string{"log-2.jsonl", "snapshot-2.jsonl"}, dataFiles(t, dir))
+	assert.ErrorIs(t, storage.AddURL("short5", "http://example5.com"), ErrClosed)
+	require.NoError(t, storage.Close())
+}
+
+func TestMemoryStorage_InterruptedSnapshot(t *testing.T) {
+	setup()
+	dir := t.TempDir()
+
+	// the log was switched to log-2 but snapshot-2 was never written
+	files := map[string]string{
+		"snapshot-0.jsonl": `{"uuid":1,"short_url":"short0","original_url":"http://example0.com"}`,
+		"snapshot-1.jsonl": `{"uuid":1,"short_url":"short1","original_url":"http://example1.com"}`,
+		"log-1.jsonl":      `{"uuid":2,"short_url":"short2","original_url":"http://example2.com"}`,
+		"log-2.jsonl":      `{"uuid":3,"short_url":"short3","original_url":"http://example3.com"}`,
+	}
+	for name, line := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(line+"\n"), 0666))
+	}
+
+	storage, err := NewMemoryStorage(dir, 0)
+	require.NoError(t, err)
+	all, err := storage.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"short1": "http://example1.com",
+		"short2": "http://example2.com",
+		"short3": "http://example3.com",
+	}, all)
+	assert.Equal(t, []string{"log-1.jsonl", "log-2.jsonl", "snapshot-1.jsonl"}, dataFiles(t, dir))
+
+	// the replayed logs are folded into the snapshot on close
+	require.NoError(t, storage.Close())
+	assert.Equal(t, []string{"log-3.jsonl", "snapshot-3.jsonl"}, dataFiles(t, dir))
+}
+
+func TestMemoryStorage_DSN(t *testing.T) {
+	setup()
+	dir := t.TempDir()
+
+	opened, err := Open("memory:" + dir + "?snapshot_interval=10ms&sync=always")
+	require.NoError(t, err)
+	storage := opened.(*MemoryStorage)
+	defer storage.Close()
+	require.NoError(t, storage.AddURL("short1", "http://example1.com"))
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, "snapshot-1.jsonl"))
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = Open("memory:" + dir + "?snapshot_interval=soon")
+	assert.Error(t, err)
+}
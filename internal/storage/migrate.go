@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"github.com/mstarodubtsev/go-yandex-shortener/internal/log"
+)
+
+// migrateBatch number of records added per transaction to a BatchWriter
+const migrateBatch = 500
+
+// MigrateReport result of a migration between storages
+type MigrateReport struct {
+	Copied      int
+	Skipped     int
+	SourceCount int
+	TargetCount int
+}
+
+// Migrate copies all records from one storage to another preserving UUIDs and
+// all record fields. Records are copied in UUID order, so an interrupted
+// migration resumes after the last UUID already present in the target.
+// Batches of records are added in one transaction to a BatchWriter.
+// The record counts of both storages are compared at the end.
+func Migrate(from, to Storage) (MigrateReport, error) {
+	var report MigrateReport
+	resumeAfter, err := lastUUID(to)
+	if err != nil {
+		return report, err
+	}
+	if resumeAfter != 0 {
+		log.Infof("Resuming migration after UUID %d", resumeAfter)
+	}
+	// a target with transactions gets the records in batches
+	batchWriter, batched := to.(BatchWriter)
+	batch := make([]DataRow, 0, migrateBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := batchWriter.AddRows(batch); err != nil {
+			return err
+		}
+		report.Copied += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+	var copyErr error
+	err = from.Range(0, false, func(row DataRow) bool {
+		report.SourceCount++
+		if row.UUID <= resumeAfter {
+			report.Skipped++
+			return true
+		}
+		if batched {
+			if batch = append(batch, row); len(batch) == migrateBatch {
+				copyErr = flush()
+			}
+			return copyErr == nil
+		}
+		if copyErr = to.AddRow(row); copyErr != nil {
+			return false
+		}
+		report.Copied++
+		return true
+	})
+	if err != nil {
+		return report, err
+	}
+	if copyErr == nil && batched {
+		copyErr = flush()
+	}
+	if copyErr != nil {
+		return report, copyErr
+	}
+	err = to.Range(0, false, func(row DataRow) bool {
+		report.TargetCount++
+		return true
+	})
+	if err != nil {
+		return report, err
+	}
+	if report.SourceCount != report.TargetCount {
+		return report, fmt.Errorf("record count mismatch: source=%d; target=%d", report.SourceCount, report.TargetCount)
+	}
+	return report, nil
+}
+
+// lastUUID returns the largest UUID in the storage, 0 if it is empty
+func lastUUID(s Storage) (int64, error) {
+	var uuid int64
+	err := s.Range(0, true, func(row DataRow) bool {
+		uuid = row.UUID
+		return false
+	})
+	return uuid, err
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestParseDSN tests the ParseDSN function
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		scheme   string
+		location string
+		wantErr  bool
+	}{
+		{dsn: "file:/tmp/storage.txt", scheme: "file", location: "/tmp/storage.txt"},
+		{dsn: "file:///tmp/storage.txt", scheme: "file", location: "/tmp/storage.txt"},
+		{dsn: "/tmp/storage.txt", wantErr: true},
+		{dsn: "file:", wantErr: true},
+	}
+	for _, tt := range tests {
+		scheme, location, err := ParseDSN(tt.dsn)
+		if tt.wantErr {
+			assert.Error(t, err, tt.dsn)
+			continue
+		}
+		require.NoError(t, err, tt.dsn)
+		assert.Equal(t, tt.scheme, scheme)
+		assert.Equal(t, tt.location, location)
+	}
+}
+
+// TestOpenUnsupported tests that unknown backends are rejected
+func TestOpenUnsupported(t *testing.T) {
+	_, err := Open("sqlite:/tmp/storage.db")
+	assert.ErrorContains(t, err, `unsupported storage backend "sqlite"`)
+}
+
+// TestMigrate tests copying and resuming a migration between storages
+func TestMigrate(t *testing.T) {
+	setup()
+	dir := t.TempDir()
+	from, err := Open("file:" + filepath.Join(dir, "from.txt"))
+	require.NoError(t, err)
+	from.AddRow(DataRow{ShortURL: "short1", OriginalURL: "http://example1.com", Tags: []string{"a"}})
+	from.AddURL("short2", "http://example2.com")
+	from.AddURL("short3", "http://example3.com")
+	row, _, _ := from.GetRow("short2")
+	row.OriginalURL = "http://example2.org"
+	from.UpdateRow(row)
+
+	// simulate an interrupted migration that copied the first record
+	targetPath := filepath.Join(dir, "to.txt")
+	to, err := Open("file:" + targetPath)
+	require.NoError(t, err)
+	first, _, _ := from.GetRow("short1")
+	require.NoError(t, to.AddRow(first))
+
+	report, err := Migrate(from, to)
+	require.NoError(t, err)
+	assert.Equal(t, MigrateReport{Copied: 2, Skipped: 1, SourceCount: 3, TargetCount: 3}, report)
+
+	require.NoError(t, to.(*FileStorage).Close())
+	reopened, err := Open("file:" + targetPath)
+	require.NoError(t, err)
+	migrated, ok, err := reopened.GetRow("short2")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, row.UUID, migrated.UUID)
+	assert.Equal(t, "http://example2.org", migrated.OriginalURL)
+
+	// new records continue after the migrated UUIDs
+	require.NoError(t, reopened.AddURL("short4", "http://example4.com"))
+	added, _, _ := reopened.GetRow("short4")
+	assert.Equal(t, int64(4), added.UUID)
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultShards number of shards of a ShardedMap created with 0 shards
+const DefaultShards = 32
+
+// mapShard part of the records guarded by its own lock
+type mapShard struct {
+	mu   sync.RWMutex
+	rows map[string]DataRow
+}
+
+// ShardedMap in-memory storage split into shards keyed by the short URL hash,
+// so writes to different shards do not wait for each other
+type ShardedMap struct {
+	shards  []*mapShard
+	counter int64
+}
+
+// NewShardedMap creates a new thread-safe in-memory storage with the given
+// number of shards, DefaultShards if 0
+func NewShardedMap(shards int) *ShardedMap {
+	if shards <= 0 {
+		shards = DefaultShards
+	}
+	m := &ShardedMap{shards: make([]*mapShard, shards)}
+	for i := range m.shards {
+		m.shards[i] = &mapShard{rows: make(map[string]DataRow)}
+	}
+	return m
+}
+
+// shard returns the shard of the short URL
+func (m *ShardedMap) shard(hash string) *mapShard {
+	// inlined FNV-1a, hash/fnv allocates on every lookup
+	h := uint32(2166136261)
+	for i := 0; i < len(hash); i++ {
+		h ^= uint32(hash[i])
+		h *= 16777619
+	}
+	return m.shards[h%uint32(len(m.shards))]
+}
+
+// AddURL adds a URL
+func (m *ShardedMap) AddURL(hash, url string) error {
+	return m.AddRow(DataRow{ShortURL: hash, OriginalURL: url})
+}
+
+// AddRow adds a record, a zero UUID is assigned by the storage,
+// otherwise the UUID is kept and the counter is moved past it
+func (m *ShardedMap) AddRow(row DataRow) error {
+	if row.UUID == 0 {
+		row.UUID = atomic.AddInt64(&m.counter, 1)
+	} else {
+		m.movePast(row.UUID)
+	}
+	if row.CreatedAt == nil {
+		now := time.Now().UTC()
+		row.CreatedAt = &now
+	}
+	m.put(row)
+	return nil
+}
+
+// put stores the record as is
+func (m *ShardedMap) put(row DataRow) {
+	shard := m.shard(row.ShortURL)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.rows[row.ShortURL] = row
+}
+
+// movePast moves the counter to the UUID unless it is already past it
+func (m *ShardedMap) movePast(uuid int64) {
+	for {
+		counter := atomic.LoadInt64(&m.counter)
+		if uuid <= counter || atomic.CompareAndSwapInt64(&m.counter, counter, uuid) {
+			return
+		}
+	}
+}
+
+// UpdateRow replaces an existing record keeping its UUID
+func (m *ShardedMap) UpdateRow(row DataRow) error {
+	if row.UUID == 0 {
+		return errors.New("cannot update a row without UUID")
+	}
+	m.put(row)
+	return nil
+}
+
+// GetURL retrieves a URL
+func (m *ShardedMap) GetURL(hash string) (string, bool, error) {
+	row, ok, err := m.GetRow(hash)
+	return row.OriginalURL, ok, err
+}
+
+// GetRow retrieves a record
+func (m *ShardedMap) GetRow(hash string) (DataRow, bool, error) {
+	shard := m.shard(hash)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	row, ok := shard.rows[hash]
+	return row, ok, nil
+}
+
+// GetAll retrieves a copy of all URLs
+func (m *ShardedMap) GetAll() (map[string]string, error) {
+	mCopy := make(map[string]string)
+	for _, shard := range m.shards {
+		shard.mu.RLock()
+		for hash, row := range shard.rows {
+			mCopy[hash] = row.OriginalURL
+		}
+		shard.mu.RUnlock()
+	}
+	return mCopy, nil
+}
+
+// Range calls fn for each record in UUID order until fn returns false, see FileStorage.Range
+func (m *ShardedMap) Range(cursor int64, desc bool, fn func(row DataRow) bool) error {
+	rows := make([]DataRow, 0)
+	for _, shard := range m.shards {
+		shard.mu.RLock()
+		for _, row := range shard.rows {
+			rows = append(rows, row)
+		}
+		shard.mu.RUnlock()
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].UUID < rows[j].UUID
+	})
+	rangeRows(rows, cursor, desc, fn)
+	return nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestShardedMap tests the storage operations of the sharded map
+func TestShardedMap(t *testing.T) {
+	m := NewShardedMap(0)
+	assert.Len(t, m.shards, DefaultShards)
+
+	require.NoError(t, m.AddURL("hash1", "https://example.com"))
+	require.NoError(t, m.AddRow(DataRow{UUID: 10, ShortURL: "hash2", OriginalURL: "https://example.org"}))
+	require.NoError(t, m.AddURL("hash3", "https://example.net"))
+
+	row, ok, err := m.GetRow("hash3")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(11), row.UUID)
+	assert.NotNil(t, row.CreatedAt)
+
+	row.OriginalURL = "https://example.net/edited"
+	require.NoError(t, m.UpdateRow(row))
+	assert.Error(t, m.UpdateRow(DataRow{ShortURL: "hash4"}))
+	url, ok, err := m.GetURL("hash3")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "https://example.net/edited", url)
+
+	_, ok, err = m.GetURL("nonexistent")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	all, err := m.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"hash1": "https://example.com",
+		"hash2": "https://example.org",
+		"hash3": "https://example.net/edited",
+	}, all)
+
+	var hashes []string
+	require.NoError(t, m.Range(11, true, func(row DataRow) bool {
+		hashes = append(hashes, row.ShortURL)
+		return true
+	}))
+	assert.Equal(t, []string{"hash2", "hash1"}, hashes)
+}
+
+// TestShardedMap_Concurrent tests concurrent writers get distinct UUIDs
+func TestShardedMap_Concurrent(t *testing.T) {
+	m := NewShardedMap(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.NoError(t, m.AddURL(fmt.Sprintf("hash%d-%d", g, i), "https://example.com"))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	uuids := make(map[int64]bool)
+	require.NoError(t, m.Range(0, false, func(row DataRow) bool {
+		uuids[row.UUID] = true
+		return true
+	}))
+	assert.Len(t, uuids, 800)
+}
+
+// mixedWorkload runs get and add in parallel, writePercent of the operations are adds
+func mixedWorkload(b *testing.B, writePercent int, get func(hash string), add func(hash, url string)) {
+	const keys = 10000
+	for i := 0; i < keys; i++ {
+		add(fmt.Sprintf("hash%d", i), "https://example.com")
+	}
+	var next int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := atomic.AddInt64(&next, 1) * 7919
+		for pb.Next() {
+			i++
+			if int(i%100) < writePercent {
+				add(fmt.Sprintf("hash%d", i%keys), "https://example.org")
+			} else {
+				get(fmt.Sprintf("hash%d", i%keys))
+			}
+		}
+	})
+}
+
+// BenchmarkMixed compares Map and ShardedMap under mixed read/write load
+func BenchmarkMixed(b *testing.B) {
+	for _, writePercent := range []int{10, 50, 90} {
+		b.Run(fmt.Sprintf("Map/writes=%d%%", writePercent), func(b *testing.B) {
+			m := NewMap()
+			mixedWorkload(b, writePercent,
+				func(hash string) { m.GetURL(hash) },
+				func(hash, url string) { m.AddURL(hash, url) })
+		})
+		b.Run(fmt.Sprintf("ShardedMap/writes=%d%%", writePercent), func(b *testing.B) {
+			m := NewShardedMap(DefaultShards)
+			mixedWorkload(b, writePercent,
+				func(hash string) { m.GetURL(hash) },
+				func(hash, url string) { m.AddURL(hash, url) })
+		})
+	}
+}
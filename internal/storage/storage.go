@@ -5,9 +5,22 @@ type Storage interface {
 	// AddURL adds url to storage
 	AddURL(hash, url string) error
 
+	// AddRow adds a full record to storage, a zero UUID is assigned by the storage
+	AddRow(row DataRow) error
+
+	// UpdateRow stores a new version of an existing record
+	UpdateRow(row DataRow) error
+
 	// GetURL gets url from storage
 	GetURL(hash string) (string, bool, error)
 
+	// GetRow gets a full record from storage
+	GetRow(hash string) (DataRow, bool, error)
+
 	// GetAll gets all urls from storage
 	GetAll() (map[string]string, error)
+
+	// Range iterates the latest version of records in creation (UUID) order
+	// starting from the cursor UUID until fn returns false
+	Range(cursor int64, desc bool, fn func(row DataRow) bool) error
 }
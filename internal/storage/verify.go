@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Kinds of problems found by VerifyFile
+const (
+	IssueCorrupted  = "corrupted"
+	IssueChecksum   = "checksum"
+	IssueDuplicate  = "duplicate"
+	IssueOutOfOrder = "out_of_order"
+)
+
+// VerifyIssue problem found on a single line of the storage file
+type VerifyIssue struct {
+	Line    int    `json:"line"`
+	Kind    string `json:"kind"`
+	UUID    int64  `json:"uuid,omitempty"`
+	Message string `json:"message"`
+}
+
+// VerifyReport result of a storage file verification
+type VerifyReport struct {
+	Lines   int           `json:"lines"`
+	Records int           `json:"records"`
+	Issues  []VerifyIssue `json:"issues,omitempty"`
+}
+
+// VerifyFile scans the storage file read-only and reports corrupted lines, lines
+// with a wrong CRC, duplicate UUIDs or short codes and records whose UUID is out
+// of order. Versions of a record written by edits share its UUID and are valid.
+//
+// If repaired is not nil a repaired copy is written to it: corrupted lines are
+// dropped, a UUID reused by another short code is renumbered past the largest
+// UUID and a short code reused with another UUID is treated as a later version
+// of the first record; out of order records are kept as they are.
+func VerifyFile(filename string, repaired io.Writer) (VerifyReport, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	defer file.Close()
+
+	v := &verifier{
+		hashes:   make(map[int64]string),
+		uuids:    make(map[string]int64),
+		repaired: repaired,
+	}
+	// the largest UUID is needed up front to renumber duplicates
+	if repaired != nil {
+		err := scanLines(file, func(line []byte, _ int64) {
+			if row, err := decodeRow(line); err == nil {
+				v.maxUUID = max(v.maxUUID, row.UUID)
+			}
+		})
+		if err != nil {
+			return v.report, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return v.report, err
+		}
+	}
+
+	buffered := bufio.NewReader(file)
+	for number := 1; ; number++ {
+		line, err := buffered.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return v.report, err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			v.verify(number, trimmed)
+		}
+		if err == io.EOF {
+			return v.report, v.err
+		}
+	}
+}
+
+// verifier state of a storage file verification
+type verifier struct {
+	report   VerifyReport
+	hashes   map[int64]string
+	uuids    map[string]int64
+	lastUUID int64
+	maxUUID  int64
+	repaired io.Writer
+	err      error
+}
+
+// verify checks a single line and writes its repaired version
+func (v *verifier) verify(number int, line []byte) {
+	v.report.Lines++
+	row, err := decodeRow(line)
+	if err != nil {
+		kind := IssueCorrupted
+		if row.CRC != 0 && row.ShortURL != "" {
+			kind = IssueChecksum
+		}
+		v.issue(number, kind, row.UUID, "%v", err)
+		return
+	}
+	if uuid, ok := v.uuids[row.ShortURL]; ok && uuid != row.UUID {
+		v.issue(number, IssueDuplicate, row.UUID, "short code %s already has UUID %d", row.ShortURL, uuid)
+		row.UUID = uuid
+		v.writeRow(&row)
+		return
+	}
+	if hash, ok := v.hashes[row.UUID]; ok && hash != row.ShortURL {
+		v.maxUUID++
+		v.issue(number, IssueDuplicate, row.UUID, "UUID already used by short code %s, renumbered to %d", hash, v.maxUUID)
+		row.UUID = v.maxUUID
+		v.add(&row)
+		v.writeRow(&row)
+		return
+	}
+	if _, ok := v.hashes[row.UUID]; !ok {
+		if row.UUID <= v.lastUUID {
+			v.issue(number, IssueOutOfOrder, row.UUID, "UUID is not greater than the previous UUID %d", v.lastUUID)
+		}
+		v.lastUUID = max(v.lastUUID, row.UUID)
+		v.add(&row)
+	}
+	v.writeLine(line)
+}
+
+// add records a new record
+func (v *verifier) add(row *DataRow) {
+	v.report.Records++
+	v.hashes[row.UUID] = row.ShortURL
+	v.uuids[row.ShortURL] = row.UUID
+}
+
+// issue reports a problem of the line
+func (v *verifier) issue(number int, kind string, uuid int64, format string, args ...interface{}) {
+	v.report.Issues = append(v.report.Issues, VerifyIssue{
+		Line:    number,
+		Kind:    kind,
+		UUID:    uuid,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// writeLine copies a valid line to the repaired copy
+func (v *verifier) writeLine(line []byte) {
+	if v.repaired == nil || v.err != nil {
+		return
+	}
+	_, v.err = v.repaired.Write(append(line, '\n'))
+}
+
+// writeRow writes a fixed record to the repaired copy
+func (v *verifier) writeRow(row *DataRow) {
+	if v.repaired == nil || v.err != nil {
+		return
+	}
+	v.err = encodeRow(v.repaired, row, row.CRC != 0)
+}
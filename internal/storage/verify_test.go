@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Checksums(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	storage, err := NewFileStorage(file.Name(), WithChecksums())
+	require.NoError(t, err)
+	require.NoError(t, storage.AddURL("short1", "http://example1.com"))
+	require.NoError(t, storage.AddURL("short2", "http://example2.com"))
+
+	row, ok, err := storage.GetRow("short1")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.NotZero(t, row.CRC)
+
+	// a changed target no longer matches the checksum and is skipped
+	data, err := os.ReadFile(file.Name())
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(file.Name(), bytes.Replace(data, []byte("example1.com"), []byte("example1.evil"), 1), 0666))
+	_, ok, err = storage.GetRow("short1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestVerifyFile(t *testing.T) {
+	setup()
+	file, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	defer os.Remove(file.Name() + ".lock")
+
+	var crcLine bytes.Buffer
+	require.NoError(t, encodeRow(&crcLine, &DataRow{UUID: 5, ShortURL: "short5", OriginalURL: "http://example5.com"}, true))
+	lines := []string{
+		`{"uuid":1,"short_url":"short1","original_url":"http://example1.com"}`,
+		`{"uuid":2,"short_url":"short2","original_url":"http://example2.com"}`,
+		// an edit of short1 keeps its UUID and is valid
+		`{"uuid":1,"short_url":"short1","original_url":"http://example1.org"}`,
+		`{"uuid":2,"short_url":"short3","original_url":"http://example3.com"}`,
+		`{"uuid":3,"short_url":"short2","original_url":"http://example2.org"}`,
+		`{"uuid":4,"short_url":`,
+		strings.Replace(strings.TrimSpace(crcLine.String()), "example5", "example6", 1),
+		`{"uuid":7,"short_url":"short7","original_url":"http://example7.com"}`,
+		`{"uuid":6,"short_url":"short6","original_url":"http://example6.com"}`,
+	}
+	file.WriteString(strings.Join(lines, "\n") + "\n")
+	file.Close()
+
+	var repaired bytes.Buffer
+	report, err := VerifyFile(file.Name(), &repaired)
+	require.NoError(t, err)
+	assert.Equal(t, 9, report.Lines)
+	assert.Equal(t, 5, report.Records)
+	kinds := make([]string, 0, len(report.Issues))
+	numbers := make([]int, 0, len(report.Issues))
+	for _, issue := range report.Issues {
+		kinds = append(kinds, issue.Kind)
+		numbers = append(numbers, issue.Line)
+	}
+	assert.Equal(t, []string{IssueDuplicate, IssueDuplicate, IssueCorrupted, IssueChecksum, IssueOutOfOrder}, kinds)
+	assert.Equal(t, []int{4, 5, 6, 7, 9}, numbers)
+
+	// the repaired copy is clean apart from out of order records, including the renumbered one
+	repairedFile, err := os.CreateTemp("", "storage_test.json")
+	require.NoError(t, err)
+	defer os.Remove(repairedFile.Name())
+	defer os.Remove(repairedFile.Name() + ".lock")
+	repairedFile.Write(repaired.Bytes())
+	repairedFile.Close()
+	report, err = VerifyFile(repairedFile.Name(), nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, report.Issues)
+	for _, issue := range report.Issues {
+		assert.Equal(t, IssueOutOfOrder, issue.Kind)
+	}
+
+	storage, err := NewFileStorage(repairedFile.Name())
+	require.NoError(t, err)
+	row, ok, err := storage.GetRow("short3")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, int64(8), row.UUID)
+	url, _, _ := storage.GetURL("short2")
+	assert.Equal(t, "http://example2.org", url)
+}